@@ -6,7 +6,7 @@ import (
 )
 
 var (
-	LEVEL_FLAGS = [...]string{"DEBUG", " INFO", " WARN", "ERROR", "FATAL"}
+	LEVEL_FLAGS = [...]string{"DEBUG", " INFO", " WARN", "ERROR", "FATAL", "PANIC"}
 	pid      = os.Getpid()
 	baseName = filepath.Base(os.Args[0])
 	hostName, _ = os.Hostname()
@@ -20,6 +20,10 @@ const (
 	WarnLevel 	LogLevel = 2
 	ErrorLevel 	LogLevel = 3
 	FatalLevel 	LogLevel = 4
+	PanicLevel 	LogLevel = 5 //后加入的级别，排在最后，已有级别的取值不变
 )
 
+//高于所有日志级别，表示 不启用按级别触发的功能(WithFlushLevel, WithStackLevel)
+const noLevel = LogLevel(len(LEVEL_FLAGS))
+
 
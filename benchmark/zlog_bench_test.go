@@ -1,6 +1,8 @@
 package bench
 
 import (
+	"context"
+	"runtime"
 	"testing"
 	"github.com/baozh/zlog"
 	"time"
@@ -83,3 +85,74 @@ func BenchmarkZlogNonePrintFileName_Singal(bb *testing.B) {
 		zlog.Debugln("Test logging, int:", a, ", float:", b, ", string:", c, ", bool:", d, ", time.Duration:", e)
 	}
 }
+
+//结构化字段 直接编码进LogMsg，-benchmem 应显示 0 allocs/op
+func BenchmarkZlogFields_Parallel(b *testing.B) {
+	zlog.SetLogLevel(zlog.DebugLevel)
+	zlog.SetWriteTypeFile("./")
+	zlog.SetPrintFileNameLineNo(false)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var a int = 1
+		var b float64 = 2.0
+		var c string = "three"
+		var d bool = true
+		var e time.Duration = 5 * time.Second
+		for pb.Next() {
+			zlog.Debugw("Test logging", zlog.Int("int", a), zlog.Float64("float", b), zlog.String("string", c),
+				zlog.Bool("bool", d), zlog.Duration("time.Duration", e))
+		}
+	})
+}
+
+func BenchmarkZlogFields_Singal(bb *testing.B) {
+	zlog.SetLogLevel(zlog.DebugLevel)
+	zlog.SetWriteTypeFile("./")
+	zlog.SetPrintFileNameLineNo(false)
+
+	var a int = 1
+	var b float64 = 2.0
+	var c string = "three"
+	var d bool = true
+	var e time.Duration = 5 * time.Second
+	bb.ReportAllocs()
+	bb.ResetTimer()
+	for i := 0; i < bb.N; i++ {
+		zlog.Debugw("Test logging", zlog.Int("int", a), zlog.Float64("float", b), zlog.String("string", c),
+			zlog.Bool("bool", d), zlog.Duration("time.Duration", e))
+	}
+}
+
+type discardSink struct{}
+
+func (discardSink) Write(content []byte) error { return nil }
+func (discardSink) Flush() error              { return nil }
+
+//对比 单个currentBuffer 与 按GOMAXPROCS分片 的并发打印性能
+func benchmarkShards(b *testing.B, shards int) {
+	logger := zlog.NewLogger(
+		zlog.WithWriter(discardSink{}),
+		zlog.WithPrintFileNameLineNo(false),
+		zlog.WithShards(shards),
+		zlog.WithOverflowBlock(0),
+	)
+	defer logger.Close(context.Background())
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			logger.Infow("Test logging", zlog.Int("int", 1), zlog.String("string", "three"))
+		}
+	})
+}
+
+func BenchmarkZlogUnsharded_Parallel(b *testing.B) {
+	benchmarkShards(b, 1)
+}
+
+func BenchmarkZlogSharded_Parallel(b *testing.B) {
+	benchmarkShards(b, runtime.GOMAXPROCS(0))
+}
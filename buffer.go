@@ -8,12 +8,17 @@ import (
 const (
 	DEFALUT_BUFFER_SIZE int = 20000*1024
 	DEFAULT_BUFFER_NUM  int = 20
+	DEFAULT_INIT_BUFFER_SIZE int = 64*1024  //buffer初始分配的空间，写入时 按需增长到DEFALUT_BUFFER_SIZE
 )
 
 type LogMsgBuffer struct {
 	buffer 		[]byte
 	startWriteIndex int   //next write index
-	capacity 	int
+	capacity 	int   //buffer最多增长到的大小
+	initSize	int   //buffer初始分配的大小，空闲时 收缩到这个大小
+	budget		*memoryBudget  //分配的空间 计入budget，nil表示不限制
+	spilled		bool  //OverflowSpill策略 临时分配的buffer，写出后 不放回emptyBuffers
+	oneOff		bool  //比一个buffer还大的日志 单独分配的buffer，写出后 释放
 }
 
 func NewLogMsgBuffer(bufferSize int) *LogMsgBuffer {
@@ -28,14 +33,82 @@ func NewLogMsgBuffer(bufferSize int) *LogMsgBuffer {
 	}
 }
 
-func (buf *LogMsgBuffer) AppendString(logStr string) {
+//按需增长的buffer：先分配initSize，写入时 翻倍增长，直到capacity
+func newGrowableBuffer(initSize int, capacity int, budget *memoryBudget) *LogMsgBuffer {
+	if initSize > capacity {
+		initSize = capacity
+	}
+	if capacity == 0 || !budget.reserve(initSize) {
+		return nil
+	}
+
+	return &LogMsgBuffer{
+		buffer: make([]byte, initSize),
+		startWriteIndex: 0,
+		capacity: capacity,
+		initSize: initSize,
+		budget: budget,
+	}
+}
+
+//保证 还能写入n个字节以上(与GetAvailLength() > n 的判断一致)，空间不够时 在capacity和budget的限制内 增长
+func (buf *LogMsgBuffer) Grow(n int) bool {
+	need := buf.startWriteIndex + n + 1
+	if need > buf.capacity {
+		return false
+	}
+	if need <= len(buf.buffer) {
+		return true
+	}
+
+	newSize := 2 * len(buf.buffer)
+	if newSize < need {
+		newSize = need
+	}
+	if newSize > buf.capacity {
+		newSize = buf.capacity
+	}
+	if !buf.budget.reserve(newSize - len(buf.buffer)) {
+		return false
+	}
+	newBuffer := make([]byte, newSize)
+	copy(newBuffer, buf.buffer[:buf.startWriteIndex])
+	buf.buffer = newBuffer
+	return true
+}
+
+//空闲时 收缩到初始大小，多余的空间 交给GC回收
+func (buf *LogMsgBuffer) shrink() {
+	if buf.startWriteIndex == 0 && len(buf.buffer) > buf.initSize {
+		buf.budget.release(len(buf.buffer) - buf.initSize)
+		buf.buffer = make([]byte, buf.initSize)
+	}
+}
+
+//释放buffer，不再使用
+func (buf *LogMsgBuffer) free() {
+	buf.budget.release(len(buf.buffer))
+	buf.buffer = nil
+	buf.startWriteIndex = 0
+}
+
+//空间不够(超过capacity，或 达到内存上限)时 返回false，不写入任何内容
+func (buf *LogMsgBuffer) AppendString(logStr string) bool {
+	if !buf.Grow(len(logStr)) {
+		return false
+	}
 	n := copy(buf.buffer[buf.startWriteIndex:], logStr)
 	buf.startWriteIndex += n;
+	return true
 }
 
-func (buf *LogMsgBuffer) AppendByte(logByte []byte) {
+func (buf *LogMsgBuffer) AppendByte(logByte []byte) bool {
+	if !buf.Grow(len(logByte)) {
+		return false
+	}
 	n := copy(buf.buffer[buf.startWriteIndex:], logByte)
 	buf.startWriteIndex += n;
+	return true
 }
 
 func (buf *LogMsgBuffer) GetLength() int {
@@ -52,14 +125,7 @@ func (buf *LogMsgBuffer) GetAvailLength() int {
 }
 
 func (buf *LogMsgBuffer) Clear() {
-	if buf.capacity > 0 {
-		if (cap(buf.buffer) == buf.capacity) {
-			buf.startWriteIndex = 0  //直接复用 之前分配的空间.
-		} else {
-			buf.buffer = make([]byte, 0, buf.capacity)
-			buf.startWriteIndex = 0
-		}
-	}
+	buf.startWriteIndex = 0  //直接复用 之前分配的空间(可能已增长)，空闲时 由shrink()收缩.
 }
 
 type BufferContainer struct {
@@ -68,6 +134,11 @@ type BufferContainer struct {
 	buffersCap 		int
 	mutex 			sync.Mutex
 	cufBufCond		*TimeoutCond
+	notified		bool      //Notify()设置，让WaitNewBuffer 即使没有新buffer 也立即返回
+	lazy			bool      //按需分配buffer，最多buffersCap个
+	initSize		int       //按需分配时 每个buffer的初始大小
+	allocated		int       //按需分配时 已分配的buffer个数(包括 已被取走的)
+	budget			*memoryBudget
 }
 
 func NewBufferContainer(bufsSize int, bufsCap int, capPerBuf int) *BufferContainer {
@@ -89,6 +160,32 @@ func NewBufferContainer(bufsSize int, bufsCap int, capPerBuf int) *BufferContain
 	return buffers
 }
 
+//按需分配buffer的容器：先分配initNum个 初始大小为initSize的buffer，PopBuffer时 若没有空闲的buffer，
+//再分配新的，最多maxNum个；每个buffer 写入时 增长到capPerBuf；分配的空间 计入budget
+func NewLazyBufferContainer(initNum int, maxNum int, initSize int, capPerBuf int, budget *memoryBudget) *BufferContainer {
+	if capPerBuf == 0 {
+		return nil
+	}
+
+	buffers := &BufferContainer{}
+	buffers.bufferCap = capPerBuf
+	buffers.buffersCap = maxNum
+	buffers.buffers = make([]*LogMsgBuffer, 0, maxNum)
+	buffers.cufBufCond = NewTimeoutCond(&buffers.mutex)
+	buffers.lazy = true
+	buffers.initSize = initSize
+	buffers.budget = budget
+	for i := 0; i < initNum && i < maxNum; i++ {
+		buf := newGrowableBuffer(initSize, capPerBuf, budget)
+		if buf == nil {
+			break
+		}
+		buffers.buffers = append(buffers.buffers, buf)
+		buffers.allocated++
+	}
+	return buffers
+}
+
 func (bufs *BufferContainer) PopBuffer() *LogMsgBuffer {
 	bufs.mutex.Lock()
 	defer bufs.mutex.Unlock()
@@ -97,11 +194,33 @@ func (bufs *BufferContainer) PopBuffer() *LogMsgBuffer {
 		buffer := bufs.buffers[0]
 		bufs.buffers = bufs.buffers[1:]    //slice 在删除某个元素时，会 自动释放 被删除元素的内存空间吗？
 		return buffer
+	} else if bufs.lazy && bufs.allocated < bufs.buffersCap {
+		buffer := newGrowableBuffer(bufs.initSize, bufs.bufferCap, bufs.budget)
+		if buffer != nil {
+			bufs.allocated++
+		}
+		return buffer
 	} else {
 		return nil
 	}
 }
 
+//释放所有空闲的buffer，交给GC回收，之后 按需重新分配
+func (bufs *BufferContainer) ReleaseIdle() {
+	bufs.mutex.Lock()
+	defer bufs.mutex.Unlock()
+
+	if !bufs.lazy {
+		return
+	}
+	for i, buf := range bufs.buffers {
+		buf.free()
+		bufs.buffers[i] = nil
+		bufs.allocated--
+	}
+	bufs.buffers = bufs.buffers[:0]
+}
+
 func (bufs *BufferContainer) GetAllBuffersAndClear() []*LogMsgBuffer {
 	bufs.mutex.Lock()
 	defer bufs.mutex.Unlock()
@@ -117,8 +236,9 @@ func (bufs *BufferContainer) PushBuffer(buf *LogMsgBuffer) {
 
 	bufs.buffers = append(bufs.buffers, buf)
 
+	//可能有多个等待者(如 OverflowBlock策略下 等待emptyBuffer的routine)，全部唤醒
 	if bufs.cufBufCond.HasWaiters() == true {
-		bufs.cufBufCond.Signal()
+		bufs.cufBufCond.Broadcast()
 	}
 }
 
@@ -129,26 +249,79 @@ func (bufs *BufferContainer) PushBuffers(tmpBufs []*LogMsgBuffer) {
 	bufs.buffers = append(bufs.buffers, tmpBufs...)
 
 	if bufs.cufBufCond.HasWaiters() == true {
-		bufs.cufBufCond.Signal()
+		bufs.cufBufCond.Broadcast()
 	}
 }
 
 func (bufs *BufferContainer) WaitNewBuffer(sec int) {
+	bufs.WaitNewBufferTimeout(time.Duration(sec) * time.Second)
+}
+
+func (bufs *BufferContainer) WaitNewBufferTimeout(timeout time.Duration) {
 	bufs.mutex.Lock()
-	if len(bufs.buffers) == 0 {  	//unsual usage!
-		bufs.cufBufCond.WaitWithTimeout(time.Duration(sec) * time.Second)
+	if len(bufs.buffers) == 0 && !bufs.notified {  	//unsual usage!
+		bufs.cufBufCond.WaitWithTimeout(timeout)
 	}
+	bufs.notified = false
 	bufs.mutex.Unlock()
 }
 
+//唤醒WaitNewBuffer，若当前没有等待者，则下一次WaitNewBuffer 不再等待
+func (bufs *BufferContainer) Notify() {
+	bufs.mutex.Lock()
+	defer bufs.mutex.Unlock()
+
+	bufs.notified = true
+	if bufs.cufBufCond.HasWaiters() == true {
+		bufs.cufBufCond.Signal()
+	}
+}
+
+//所有buffer中 尚未写出的字节数
+func (bufs *BufferContainer) PendingBytes() int {
+	bufs.mutex.Lock()
+	defer bufs.mutex.Unlock()
+
+	bytes := 0
+	for _, buf := range bufs.buffers {
+		bytes += buf.GetLength()
+	}
+	return bytes
+}
+
 func (bufs *BufferContainer) WaitNewBufferUnlimitedTime() {
+	bufs.WaitBuffersMoreThan(0)
+}
+
+//一直等待，直到 可用buffer的个数 大于n
+func (bufs *BufferContainer) WaitBuffersMoreThan(n int) {
 	bufs.mutex.Lock()
-	for ; len(bufs.buffers) == 0; {
-		bufs.cufBufCond.Wait()
+	for ; bufs.available() <= n; {
+		if bufs.lazy {
+			//内存上限 由别处释放时 不会通知这里，定期检查
+			bufs.cufBufCond.WaitWithTimeout(100 * time.Millisecond)
+		} else {
+			bufs.cufBufCond.Wait()
+		}
 	}
 	bufs.mutex.Unlock()
 }
 
+//可用的buffer个数：空闲的，加上 还可以分配的
+func (bufs *BufferContainer) Available() int {
+	bufs.mutex.Lock()
+	defer bufs.mutex.Unlock()
+	return bufs.available()
+}
+
+func (bufs *BufferContainer) available() int {
+	n := len(bufs.buffers)
+	if bufs.lazy && bufs.budget.canReserve(bufs.initSize) {
+		n += bufs.buffersCap - bufs.allocated
+	}
+	return n
+}
+
 func (bufs *BufferContainer) IsEmpty() bool {
 	bufs.mutex.Lock()
 	defer bufs.mutex.Unlock()
@@ -0,0 +1,99 @@
+package zlog
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuffersAllocatedOnDemand(t *testing.T) {
+	logger := NewLogger(WithWriter(&memorySink{}))
+	if n := logger.Stats().MemoryInUse; n > int64(2*DEFAULT_INIT_BUFFER_SIZE) {
+		t.Fatalf("memory in use after NewLogger = %d", n)
+	}
+
+	buf := newGrowableBuffer(16, 64, nil)
+	buf.AppendString(strings.Repeat("x", 40))
+	if buf.GetLength() != 40 || len(buf.buffer) < 41 {
+		t.Fatalf("buffer did not grow: length %d, allocated %d", buf.GetLength(), len(buf.buffer))
+	}
+	if buf.Grow(30) {
+		t.Fatal("buffer grew beyond its capacity")
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	const limit = 256 * 1024
+	sink := newGatedSink()
+	logger := NewLogger(WithWriter(sink), WithBufferSize(128*1024), WithMemoryLimit(limit), WithOverflowSpill(1024*1024))
+	for i := 0; i < 5000; i++ {
+		logger.Infow("fill the buffers", Int("i", i))
+		if n := logger.Stats().MemoryInUse; n > limit {
+			t.Fatalf("memory in use = %d, over the limit %d", n, limit)
+		}
+	}
+	close(sink.gate)
+	syncLogger(t, logger)
+	if logger.Stats().TotalDroppedEntries() == 0 {
+		t.Fatal("expected entries to be dropped at the memory limit")
+	}
+}
+
+func TestIdleBuffersReleased(t *testing.T) {
+	sink := &memorySink{}
+	logger := NewLogger(WithWriter(sink), WithFlushInterval(1), WithIdleRelease(time.Millisecond))
+	for i := 0; i < 2000; i++ {
+		logger.Infow("grow the current buffer", Int("i", i))
+	}
+	if n := logger.Stats().MemoryInUse; n <= int64(DEFAULT_INIT_BUFFER_SIZE) {
+		t.Fatalf("memory in use = %d, buffer should have grown", n)
+	}
+	syncLogger(t, logger)
+
+	for i := 0; i < 50; i++ {
+		if logger.Stats().MemoryInUse <= int64(DEFAULT_INIT_BUFFER_SIZE) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("idle buffers not released, memory in use = %d", logger.Stats().MemoryInUse)
+}
+
+//丢失提示 写不下当前buffer时，换一个空的buffer，不能被截断
+func TestLostMarkerNotCut(t *testing.T) {
+	sink := &memorySink{}
+	logger := NewLogger(WithWriter(sink), WithBufferSize(256), WithFlushInterval(60))
+	shard := &logger.shards[0]
+	shard.mutex.Lock()
+	if shard.currentBuffer == nil {
+		shard.currentBuffer = logger.emptyBuffers.PopBuffer()
+	}
+	filler := strings.Repeat("x", 200) + "\n"
+	if !shard.currentBuffer.AppendString(filler) {
+		t.Fatal("filler does not fit")
+	}
+	shard.mutex.Unlock()
+
+	logger.countDrop(InfoLevel, 10)
+	WaitingAndSetCurrentBuf(logger, time.Now())
+	syncLogger(t, logger)
+
+	out := sink.String()
+	if !strings.HasPrefix(out, filler+"Lost log msg, StartTime:") || !strings.HasSuffix(out, ", Dropped:1, Bytes:10, INFO:1\n") {
+		t.Fatalf("output = %q", out)
+	}
+}
+
+//buffer比丢失提示还小时，这次的丢失 留到下一次提示
+func TestLostMarkerKeptWhenBufferTooSmall(t *testing.T) {
+	logger := NewLogger(WithWriter(&memorySink{}), WithBufferSize(64), WithFlushInterval(60))
+	logger.countDrop(WarnLevel, 10)
+	WaitingAndSetCurrentBuf(logger, time.Now())
+
+	if n := logger.reported.DroppedEntries[WarnLevel]; n != 0 {
+		t.Fatalf("unwritten loss marked as reported: %d", n)
+	}
+	if summary := logger.lossSummary(); summary != ", Dropped:1, Bytes:10, WARN:1" {
+		t.Fatalf("next summary = %q", summary)
+	}
+}
@@ -2,94 +2,205 @@ package zlog
 
 import (
 	"fmt"
+	"runtime"
+	"strconv"
 	"time"
 )
 
 func (l *Logger) print(level LogLevel, args ...interface{}) {
-	msg := l.writer.formatHeader(level, l.isPrintFileNameLineNo)
-	fmt.Fprint(msg, args...)
-	msg.appendByte('\n')
-	l.writeBuf(msg)
-	msg.Clear()
-	recordPool.Put(msg)
+	ent := l.newEntry(level)
+	body := recordPool.Get().(*LogMsg)
+	fmt.Fprint(body, args...)
+	ent.Message = body.GetBytes()
+	l.output(ent)
+	body.Clear()
+	recordPool.Put(body)
 }
 
 func (l *Logger) printf(level LogLevel, format string, args ...interface{}) {
-	msg := l.writer.formatHeader(level, l.isPrintFileNameLineNo)
-	fmt.Fprintf(msg, format, args...)
-	msg.appendByte('\n')
-	l.writeBuf(msg)
+	ent := l.newEntry(level)
+	body := recordPool.Get().(*LogMsg)
+	fmt.Fprintf(body, format, args...)
+	ent.Message = body.GetBytes()
+	l.output(ent)
+	body.Clear()
+	recordPool.Put(body)
+}
+
+func (l *Logger) printw(level LogLevel, message string, fields []Field) {
+	ent := l.newEntry(level)
+	body := recordPool.Get().(*LogMsg)
+	body.growString(message)
+	ent.Message = body.GetBytes()
+	ent.Fields = append(ent.Fields, fields...) //复制一份，避免 调用方的fields 逃逸到堆上
+	l.output(ent)
+	body.Clear()
+	recordPool.Put(body)
+}
+
+//组装Entry，只能由print/printf/printw调用，以保证 runtime.Caller 的调用深度
+func (l *Logger) newEntry(level LogLevel) *Entry {
+	ent := entryPool.Get().(*Entry)
+	ent.Level = level
+	ent.Time = time.Now()
+	if len(l.shards) > 1 {
+		//分片之间 没有先后顺序，用序号 在下游排序
+		ent.Seq = l.seq.Add(1)
+	}
+
+	if l.isPrintFileNameLineNo.Load() {
+		//获取源文件名，行号，函数名
+		pc, file, line, ok := runtime.Caller(3)
+		if ok {
+			ent.File = file
+			ent.Line = line
+			if funcPtr := runtime.FuncForPC(pc); funcPtr != nil {
+				ent.Func = funcPtr.Name()
+			}
+		} else {
+			ent.File = "NoneFileName"
+			ent.Line = 1
+			ent.Func = "NoneFuncName"
+		}
+		ent.HasCaller = true
+	}
+
+	if level >= l.stackLevel {
+		//只记录PC，编码时 再解析
+		ent.Stack = ent.pcs[:runtime.Callers(4, ent.pcs[:])]
+	}
+	return ent
+}
+
+//文本格式：header之后 依次是 上下文字段、正文、结构化字段
+func (log *LogMsg) appendTextBody(ent *Entry) {
+	log.growBytes(ent.Context)
+	log.growBytes(ent.Message)
+	log.appendFields(ent.Fields)
+	log.appendTextStack(ent.Stack)
+	log.growByte('\n')
+}
+
+//编码Entry，写入buffer
+func (l *Logger) output(ent *Entry) {
+	msg := recordPool.Get().(*LogMsg)
+	enc := l.encoder.Load()
+	l.encodeEntry(enc, msg, ent)
+	l.writeBuf(msg, ent, enc)
+	level := ent.Level
 	msg.Clear()
 	recordPool.Put(msg)
+	ent.reset()
+	entryPool.Put(ent)
+
+	//重要的日志 立即交给 刷日志routine 写出，见WithFlushLevel
+	if level >= l.flushLevel {
+		l.flushEntry()
+	}
 }
 
-func (l *Logger) writeBuf(msg *LogMsg) {
-	//写入currentBuf
-	notHaveEnoughBuffer := false
-	l.curBufMutex.Lock()
-	if l.currentBuffer != nil {
-		//先判断curBuf 是否有足够的空间写入
-		if l.currentBuffer.GetAvailLength() > msg.GetLength() {
-			l.currentBuffer.AppendByte(msg.GetBytes())
+func (l *Logger) encodeEntry(enc *encoderHolder, msg *LogMsg, ent *Entry) {
+	//上下文字段 必须与日志 用同一个编码器编码
+	ent.Context = l.contextFor(enc)
+	enc.EncodeEntry(msg, ent)
+	if l.maxEntrySize > 0 && msg.GetLength() > l.maxEntrySize {
+		l.truncateEntry(enc, msg, ent)
+	}
+}
+
+func (l *Logger) writeBuf(msg *LogMsg, ent *Entry, enc *encoderHolder) {
+	//写入分片的currentBuf，没有可用的buffer时 按overflowPolicy处理
+	level := ent.Level
+	shard := l.lockShard(msg)
+	defer shard.mutex.Unlock()
+	if l.closed.Load() {
+		//已经Close()，刷日志routine 已退出
+		return
+	}
+	//编码之后 加锁之前，编码器随writer一起更换了(SetWriteTypeFile等)：
+	//用新的编码器 重新编码，保证 新writer收到的日志 都是新的格式
+	if cur := l.encoder.Load(); cur != enc {
+		msg.Clear()
+		l.encodeEntry(cur, msg, ent)
+	}
+
+	var written bool
+	switch {
+	case msg.GetLength() >= l.bufferSize:
+		//比一个buffer还大，单独分配buffer
+		written = l.appendLarge(shard, msg)
+	case l.overflowPolicy == OverflowBlock:
+		written = l.appendOrWait(shard, msg, l.overflowTimeout)
+	case l.overflowPolicy == OverflowSpill:
+		written = l.appendCurrent(shard, msg) || l.appendSpill(shard, msg)
+	case l.overflowPolicy == OverflowDropByLevel:
+		if level >= l.keepLevel {
+			written = l.appendOrWait(shard, msg, 0)
 		} else {
-			//如果空间不够，则push 到 fullBufs，然后 申请一个emptyfull，写入 日志串，再唤醒 routine(flushFullBuffers).
-			l.fullBuffers.PushBuffer(l.currentBuffer)
-			l.currentBuffer = l.emptyBuffers.PopBuffer()
-			if l.currentBuffer != nil {
-				l.currentBuffer.AppendByte(msg.GetBytes())
-			} else {
-				notHaveEnoughBuffer = true
-			}
+			written = l.appendOrShed(shard, msg)
 		}
-	} else {
-		notHaveEnoughBuffer = true
+	default:
+		written = l.appendCurrent(shard, msg)
 	}
-	l.curBufMutex.Unlock()
 
-	//currentBuffer 为空，说明 没有可用buf了，消费速度 跟不上 生产速度，则丢弃日志
-	if notHaveEnoughBuffer == true {
+	//没有写入，说明 没有可用buf了，消费速度 跟不上 生产速度，则丢弃日志
+	if !written {
+		l.countDrop(level, msg.GetLength())
 		//丢弃日志的时候，也要打印相关信息
 		//这时 等待 可用的 emptybuffer, 启一个routine 来设置 currentBuf
-		if l.isWaitingAvailBuffer == false {
+		if l.isWaitingAvailBuffer.CompareAndSwap(false, true) {
 			go WaitingAndSetCurrentBuf(l, time.Now())
-			l.isWaitingAvailBuffer = true
 		}
 	}
 }
 
 func (l *Logger) wakeup() {
-	l.curBufMutex.Lock()
-	if (l.currentBuffer != nil && l.currentBuffer.GetLength() > 0) {
-		l.fullBuffers.PushBuffer(l.currentBuffer)
-		l.currentBuffer = l.emptyBuffers.PopBuffer()
-	}
-	l.curBufMutex.Unlock()
+	l.pushShards()
 }
 
 func WaitingAndSetCurrentBuf(l *Logger, startTime time.Time) {
-	//等待可用的empty buf，并设置 currentBuf
-	l.emptyBuffers.WaitNewBufferUnlimitedTime()
+	//等待可用的empty buf，并设置 第一个分片的currentBuf
+	//OverflowDropByLevel策略下，要等 空闲buffer 多于保留的个数，即 不再丢弃低级别的日志
+	shard := &l.shards[0]
+	for {
+		l.emptyBuffers.WaitBuffersMoreThan(l.overflowReserve())
+		shard.mutex.Lock()
+		if shard.currentBuffer == nil {
+			shard.currentBuffer = l.emptyBuffers.PopBuffer()
+		}
+		if shard.currentBuffer != nil {
+			break
+		}
+		shard.mutex.Unlock()
+	}
 
 	endTime := time.Now()
+	reported := l.reported
 	logStr := "Lost log msg, StartTime:" + startTime.Format("2006-01-02 15:04:05.999999") +
-				", EndTime:" + endTime.Format("2006-01-02 15:04:05.999999") + "\n"
+				", EndTime:" + endTime.Format("2006-01-02 15:04:05.999999") + l.lossSummary() + "\n"
 
-	//将提示信息（丢弃日志串）, startTime, endTime 写入到curBufer中
-	l.curBufMutex.Lock()
-	l.currentBuffer = l.emptyBuffers.PopBuffer()
-	l.currentBuffer.AppendString(logStr)
-	l.curBufMutex.Unlock()
-
-	l.isWaitingAvailBuffer = false
+	//将提示信息（丢弃日志串）, startTime, endTime, 丢弃的条数和字节数 写入到curBufer中
+	//curBufer写不下时，交给 刷日志routine，换一个空的buffer再写
+	if !shard.currentBuffer.AppendString(logStr) {
+		l.pushShardLocked(shard)
+		if shard.currentBuffer == nil || !shard.currentBuffer.AppendString(logStr) {
+			//仍写不下(buffer太小 或 达到内存上限)：这次的丢失 留到下一次提示中，不丢掉统计
+			l.reported = reported
+		}
+	}
+	l.isWaitingAvailBuffer.Store(false)
+	shard.mutex.Unlock()
 }
 
 const (
 	DEFALUT_LOG_SIZE int = 4000
+	MAX_POOLED_LOG_SIZE int = 64*1024  //LogMsg放回pool时 最多保留的空间
 )
 
 type LogMsg struct {
 	logContentTmp  [DEFALUT_LOG_SIZE]byte
 	writeIndex int
+	shard uint32  //写入时 优先选择的分片，创建时 轮流分配
 
 	logContent []byte
 	logContentSize int
@@ -98,12 +209,18 @@ type LogMsg struct {
 func NewLogMsg() *LogMsg {
 	msg := &LogMsg {}
 	msg.logContentSize = DEFALUT_LOG_SIZE
+	msg.shard = nextShard.Add(1)
 	msg.logContent = msg.logContentTmp[:msg.logContentSize]
 	return msg
 }
 
 func (log *LogMsg) Clear() {
 	log.writeIndex = 0
+	//打印过大日志后 扩容的空间 不随pool保留
+	if log.logContentSize > MAX_POOLED_LOG_SIZE {
+		log.logContentSize = DEFALUT_LOG_SIZE
+		log.logContent = log.logContentTmp[:log.logContentSize]
+	}
 }
 
 func (log *LogMsg) Avail() int {
@@ -119,15 +236,13 @@ func (log *LogMsg) GetBytes() []byte {
 }
 
 func (log *LogMsg) appendInt(value int) {
+	log.reserve(20)
 	n := log.someDigits(log.writeIndex, value)
 	log.writeIndex += n
 }
 
 func (log *LogMsg) appendByte(value byte) {
-	if (log.logContentSize - log.writeIndex > 1) {
-		log.logContent[log.writeIndex] = value
-		log.writeIndex++
-	}
+	log.growByte(value)
 }
 
 func (log *LogMsg) setString(value string) {
@@ -136,22 +251,68 @@ func (log *LogMsg) setString(value string) {
 }
 
 func (log *LogMsg) appendString(value string) {
-	n := copy(log.logContent[log.writeIndex:], value)
-	log.writeIndex += n
+	log.growString(value)
+}
+
+//strconv.AppendXXX 空间不够时会重新分配，统一在这里接管 新的slice
+func (log *LogMsg) setBytes(b []byte) {
+	log.logContent = b[:cap(b)]
+	log.logContentSize = cap(b)
+	log.writeIndex = len(b)
+}
+
+//与appendByte/appendString不同，空间不够时自动扩容
+func (log *LogMsg) growByte(value byte) {
+	log.setBytes(append(log.logContent[:log.writeIndex], value))
+}
+
+func (log *LogMsg) growString(value string) {
+	log.setBytes(append(log.logContent[:log.writeIndex], value...))
+}
+
+func (log *LogMsg) growBytes(value []byte) {
+	log.setBytes(append(log.logContent[:log.writeIndex], value...))
 }
 
-func (log *LogMsg) Write(value []byte) (retN int, err error) {
-	if (log.logContentSize - log.writeIndex > len(value)) {
-		retN := copy(log.logContent[log.writeIndex:], value)
-		log.writeIndex += retN
-	} else {
+//保证至少有n个字节的剩余空间，用于 按下标写入(twoDigits, nDigits...)
+func (log *LogMsg) reserve(n int) {
+	if log.logContentSize-log.writeIndex < n {
 		tmp := log.logContent
-		log.logContent = make([]byte, 2*(log.writeIndex + len(value)))
-		copy(log.logContent[0:], tmp[:log.writeIndex])
-		retN := copy(log.logContent[log.writeIndex:], value)
-		log.writeIndex += retN
+		log.logContent = make([]byte, 2*(log.writeIndex+n))
+		log.logContentSize = len(log.logContent)
+		copy(log.logContent, tmp[:log.writeIndex])
 	}
-	return retN, nil
+}
+
+//供第三方Encoder使用，空间不够时自动扩容
+func (log *LogMsg) AppendByte(value byte) {
+	log.growByte(value)
+}
+
+func (log *LogMsg) AppendString(value string) {
+	log.growString(value)
+}
+
+func (log *LogMsg) AppendBytes(value []byte) {
+	log.growBytes(value)
+}
+
+func (log *LogMsg) AppendInt(value int64) {
+	log.setBytes(strconv.AppendInt(log.logContent[:log.writeIndex], value, 10))
+}
+
+func (log *LogMsg) AppendTime(value time.Time, layout string) {
+	log.setBytes(value.AppendFormat(log.logContent[:log.writeIndex], layout))
+}
+
+//按文本格式(key=value)追加字段
+func (log *LogMsg) AppendTextFields(fields []Field) {
+	log.appendFields(fields)
+}
+
+func (log *LogMsg) Write(value []byte) (int, error) {
+	log.growBytes(value)
+	return len(value), nil
 }
 
 // Some custom tiny helper functions to print the log header efficiently.
@@ -0,0 +1,112 @@
+package zlog
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+//打印日志 与 修改日志级别、输出目的地 等运行期配置 并发进行，用 go test -race 运行
+func TestConcurrentConfigAndLogging(t *testing.T) {
+	defer func() {
+		SetWriteTypeConsole()
+		SetLogLevel(DebugLevel)
+		SetPrintFileNameLineNo(true)
+	}()
+	dir := t.TempDir()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			child := Default().With(Int("worker", i))
+			for n := 0; ; n++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				Debuglnf("debug %d", n)
+				Infoln("info", n)
+				Warnw("warn", Int("n", n))
+				child.Errorw("error", String("k", "v"))
+			}
+		}(i)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		levels := []LogLevel{DebugLevel, InfoLevel, WarnLevel, ErrorLevel}
+		for n := 0; ; n++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			SetLogLevel(levels[n%len(levels)])
+			SetPrintFileNameLineNo(n%2 == 0)
+			if n%50 == 0 {
+				if err := SetWriteTypeFile(dir); err != nil {
+					t.Error(err)
+				}
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(20 * time.Millisecond):
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			Sync(ctx)
+			cancel()
+			Default().Stats()
+			Default().Level()
+		}
+	}()
+
+	time.Sleep(300 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//多个Logger 各自Close，与打印日志并发进行
+func TestConcurrentClose(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		sink := &memorySink{}
+		logger := NewLogger(WithWriter(sink), WithBufferNum(2), WithBufferSize(4096))
+
+		var wg sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for n := 0; n < 200; n++ {
+					logger.Infow("line", Int("n", n))
+				}
+			}()
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := logger.Close(ctx); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		wg.Wait()
+	}
+}
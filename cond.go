@@ -2,6 +2,7 @@ package zlog
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -9,22 +10,23 @@ import (
 type TimeoutCond struct {
 	L          sync.Locker
 	signal     chan int
-	hasWaiters bool
+	waiters    atomic.Int32 //等待者的个数
 }
 
 // NewTimeoutCond return a new TimeoutCond
 func NewTimeoutCond(l sync.Locker) *TimeoutCond {
-	cond := TimeoutCond{L: l, signal: make(chan int, 0)}
+	//带一个缓冲，等待者 解锁之后、进入select之前 到达的Signal 不会丢失
+	cond := TimeoutCond{L: l, signal: make(chan int, 1)}
 	return &cond
 }
 
 // WaitWithTimeout wait for signal return remain wait time, and is interrupted
 func (cond *TimeoutCond) WaitWithTimeout(timeout time.Duration) (time.Duration, bool) {
-	cond.setHasWaiters(true)
+	cond.addWaiter(1)
 	ch := cond.signal
 	//wait should unlock mutex,  if not will cause deadlock
 	cond.L.Unlock()
-	defer cond.setHasWaiters(false)
+	defer cond.addWaiter(-1)
 	defer cond.L.Lock()
 
 	begin := time.Now().UnixNano()
@@ -38,22 +40,22 @@ func (cond *TimeoutCond) WaitWithTimeout(timeout time.Duration) (time.Duration,
 	}
 }
 
-func (cond *TimeoutCond) setHasWaiters(value bool) {
-	cond.hasWaiters = value
+func (cond *TimeoutCond) addWaiter(delta int) {
+	cond.waiters.Add(int32(delta))
 }
 
 // HasWaiters queries whether any goroutine are waiting on this condition
 func (cond *TimeoutCond) HasWaiters() bool {
-	return cond.hasWaiters
+	return cond.waiters.Load() > 0
 }
 
 // Wait for signal return waiting is interrupted
 func (cond *TimeoutCond) Wait() bool {
-	cond.setHasWaiters(true)
+	cond.addWaiter(1)
 	//copy signal in lock, avoid data race with Interrupt
 	ch := cond.signal
 	cond.L.Unlock()
-	defer cond.setHasWaiters(false)
+	defer cond.addWaiter(-1)
 	defer cond.L.Lock()
 	_, ok := <-ch
 	return !ok
@@ -67,10 +69,16 @@ func (cond *TimeoutCond) Signal() {
 	}
 }
 
+// Broadcast wakes all goroutines waiting on c, caller must hold L
+func (cond *TimeoutCond) Broadcast() {
+	close(cond.signal)
+	cond.signal = make(chan int, 1)
+}
+
 // Interrupt goroutine wait on this TimeoutCond
 func (cond *TimeoutCond) Interrupt() {
 	cond.L.Lock()
 	defer cond.L.Unlock()
 	close(cond.signal)
-	cond.signal = make(chan int, 0)
+	cond.signal = make(chan int, 1)
 }
@@ -0,0 +1,68 @@
+package zlog
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+//一条日志的全部信息，由Logger组装，交给编码器 编码成字节串
+type Entry struct {
+	Level     LogLevel
+	Time      time.Time
+	HasCaller bool   //是否带有 源文件名，行号，函数名
+	File      string //源文件的完整路径
+	Line      int
+	Func      string
+	Context   []byte //With() 预先编码好的字段
+	Message   []byte
+	Fields    []Field
+	Seq       uint64    //日志的序号，分片多于一个时(WithShards) 才有，从1开始，用于 下游按打印顺序排序
+	Stack     []uintptr //调用栈的PC，从打印日志的函数开始，WithStackLevel的级别及以上 才有，用StackFrames()解析
+
+	pcs [maxStackDepth]uintptr //Stack的存储空间，随Entry复用
+}
+
+var entryPool = sync.Pool{
+	New: func() interface{} {
+		return new(Entry)
+	},
+}
+
+//只保留 源文件名，去掉路径
+func (ent *Entry) ShortFile() string {
+	slash := strings.LastIndex(ent.File, "/")
+	if slash >= 0 {
+		return ent.File[slash+1:]
+	}
+	return ent.File
+}
+
+func (ent *Entry) reset() {
+	ent.HasCaller = false
+	ent.Seq = 0
+	ent.Stack = nil
+	ent.File = ""
+	ent.Func = ""
+	ent.Context = nil
+	ent.Message = nil
+	for i := range ent.Fields {
+		ent.Fields[i] = Field{} //释放字段中的引用
+	}
+	ent.Fields = ent.Fields[:0]
+}
+
+//编码器：将Entry编码成字节串，追加到msg中
+//第三方的编码器 可用LogMsg的AppendXXX方法 拼装日志串
+type Encoder interface {
+	EncodeEntry(msg *LogMsg, ent *Entry)
+	EncodeFields(msg *LogMsg, fields []Field) //编码With()的上下文字段，结果存入Entry.Context
+}
+
+//输出目的地：将编码好的字节串 写入屏幕、文件等
+//Write 和 Flush 只会在 刷日志routine 中调用
+//返回的错误 交给Logger的错误处理函数(见WithErrorHandler)，Write失败的内容 改写到备用输出(见WithFallback)
+type Sink interface {
+	Write(content []byte) error
+	Flush() error
+}
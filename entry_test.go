@@ -0,0 +1,86 @@
+package zlog
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//第三方的编码器：level|file:line|context|message|fields
+type pipeEncoder struct{}
+
+func (pipeEncoder) EncodeEntry(msg *LogMsg, ent *Entry) {
+	msg.AppendString(strings.TrimSpace(LEVEL_FLAGS[ent.Level]))
+	msg.AppendByte('|')
+	if ent.HasCaller {
+		msg.AppendString(ent.ShortFile())
+		msg.AppendByte(':')
+		msg.AppendInt(int64(ent.Line))
+	}
+	msg.AppendByte('|')
+	msg.AppendBytes(ent.Context)
+	msg.AppendByte('|')
+	msg.AppendBytes(ent.Message)
+	msg.AppendByte('|')
+	msg.AppendTextFields(ent.Fields)
+	msg.AppendByte('\n')
+}
+
+func (pipeEncoder) EncodeFields(msg *LogMsg, fields []Field) {
+	for _, f := range fields {
+		msg.AppendString(f.Key)
+		msg.AppendByte(';')
+	}
+}
+
+func TestCustomEncoderWithAnySink(t *testing.T) {
+	sink := &memorySink{}
+	logger := NewLogger(WithWriter(sink), WithEncoder(pipeEncoder{}))
+	logger.With(String("req", "abc"), Int("user", 7)).Warnw("hello", Bool("ok", true))
+	syncLogger(t, logger)
+
+	want := "WARN|entry_test.go:"
+	if out := sink.String(); !strings.HasPrefix(out, want) || !strings.HasSuffix(out, "|req;user;|hello| ok=true\n") {
+		t.Fatalf("custom encoder output = %q", out)
+	}
+}
+
+//同一个编码器 可以配合不同的Sink，同一个Sink 也可以配合不同的编码器
+func TestEncoderAndSinkAreIndependent(t *testing.T) {
+	dir := t.TempDir()
+	fw, err := NewFileWriter(nil, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonToFile := NewLogger(WithWriter(fw), WithEncoder(NewJSONEncoder()))
+	sink := &memorySink{}
+	jsonToMemory := NewLogger(WithWriter(sink), WithEncoder(NewJSONEncoder()))
+	textToMemory := NewLogger(WithWriter(sink), WithPrintFileNameLineNo(false))
+
+	jsonToFile.Infow("file", Int("n", 1))
+	jsonToMemory.Infow("memory", Int("n", 2))
+	syncLogger(t, jsonToFile)
+	syncLogger(t, jsonToMemory)
+	textToMemory.Infow("text", Int("n", 3))
+	syncLogger(t, textToMemory)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("log dir entries = %v, %v", entries, err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal(content, &obj); err != nil || obj["msg"] != "file" || obj["n"] != float64(1) {
+		t.Fatalf("file content = %q, %v", content, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(sink.String()), "\n")
+	if len(lines) != 2 || !json.Valid([]byte(lines[0])) || !strings.HasSuffix(lines[1], "- text n=3") {
+		t.Fatalf("memory sink content = %q", lines)
+	}
+}
@@ -0,0 +1,149 @@
+package zlog
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+type FieldType uint8
+
+const (
+	UnknownType FieldType = iota
+	StringType
+	Int64Type
+	Float64Type
+	BoolType
+	DurationType
+	TimeType
+	ErrorType
+	AnyType
+)
+
+//结构化日志的 key/value 字段
+//值按类型存放在Integer/String/Interface中，构造时不经过interface装箱(Any除外)，
+//编码时直接写入LogMsg的字节数组，不经过反射和fmt.
+type Field struct {
+	Key       string
+	Type      FieldType
+	Integer   int64
+	String    string
+	Interface interface{}
+}
+
+const fieldTimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+func String(key string, value string) Field {
+	return Field{Key: key, Type: StringType, String: value}
+}
+
+func Int(key string, value int) Field {
+	return Field{Key: key, Type: Int64Type, Integer: int64(value)}
+}
+
+func Int64(key string, value int64) Field {
+	return Field{Key: key, Type: Int64Type, Integer: value}
+}
+
+func Float64(key string, value float64) Field {
+	return Field{Key: key, Type: Float64Type, Integer: int64(math.Float64bits(value))}
+}
+
+func Bool(key string, value bool) Field {
+	var i int64
+	if value {
+		i = 1
+	}
+	return Field{Key: key, Type: BoolType, Integer: i}
+}
+
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, Type: DurationType, Integer: int64(value)}
+}
+
+//只保存 纳秒时间戳 和 时区指针，避免复制time.Time时装箱
+func Time(key string, value time.Time) Field {
+	return Field{Key: key, Type: TimeType, Integer: value.UnixNano(), Interface: value.Location()}
+}
+
+//key固定为"error"
+func Err(err error) Field {
+	return Field{Key: "error", Type: ErrorType, Interface: err}
+}
+
+//任意类型，编码时用fmt输出，会有额外的开销
+func Any(key string, value interface{}) Field {
+	return Field{Key: key, Type: AnyType, Interface: value}
+}
+
+func (f *Field) timeValue() time.Time {
+	t := time.Unix(0, f.Integer)
+	if loc, ok := f.Interface.(*time.Location); ok && loc != nil {
+		t = t.In(loc)
+	}
+	return t
+}
+
+//文本格式：key=value，多个字段以空格分隔
+func (log *LogMsg) appendFields(fields []Field) {
+	for i := range fields {
+		log.growByte(' ')
+		log.appendField(&fields[i])
+	}
+}
+
+func (log *LogMsg) appendField(f *Field) {
+	log.growString(f.Key)
+	log.growByte('=')
+
+	switch f.Type {
+	case StringType:
+		log.appendTextString(f.String)
+	case Int64Type:
+		log.setBytes(strconv.AppendInt(log.logContent[:log.writeIndex], f.Integer, 10))
+	case Float64Type:
+		log.setBytes(strconv.AppendFloat(log.logContent[:log.writeIndex], math.Float64frombits(uint64(f.Integer)), 'g', -1, 64))
+	case BoolType:
+		log.setBytes(strconv.AppendBool(log.logContent[:log.writeIndex], f.Integer != 0))
+	case DurationType:
+		//以秒为单位输出(例如 1.5s)，可被time.ParseDuration解析，且不像Duration.String()那样分配内存
+		log.setBytes(strconv.AppendFloat(log.logContent[:log.writeIndex], time.Duration(f.Integer).Seconds(), 'f', -1, 64))
+		log.growByte('s')
+	case TimeType:
+		log.setBytes(f.timeValue().AppendFormat(log.logContent[:log.writeIndex], fieldTimeLayout))
+	case ErrorType:
+		if err, ok := f.Interface.(error); ok && err != nil {
+			log.appendTextString(err.Error())
+		} else {
+			log.growString("<nil>")
+		}
+	case AnyType:
+		fmt.Fprint(log, f.Interface)
+	default:
+		log.growString("<unknown>")
+	}
+}
+
+//值中含有空格、引号、'='或控制字符时，加引号输出，便于按 key=value 解析
+func (log *LogMsg) appendTextString(value string) {
+	needQuote := len(value) == 0
+	for i := 0; i < len(value) && !needQuote; i++ {
+		c := value[i]
+		needQuote = c <= ' ' || c == '"' || c == '=' || c == 0x7f
+	}
+
+	if needQuote {
+		log.setBytes(strconv.AppendQuote(log.logContent[:log.writeIndex], value))
+	} else {
+		log.growString(value)
+	}
+}
+
+//With()的上下文字段(文本格式)：每个 key=value 后跟一个空格，拼在正文之前
+func (log *LogMsg) appendContextFields(fields []Field) {
+	for i := range fields {
+		log.appendField(&fields[i])
+		log.growByte(' ')
+	}
+}
@@ -0,0 +1,148 @@
+package zlog
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+type point struct {
+	X, Y int
+}
+
+func TestTextFieldTypes(t *testing.T) {
+	when := time.Date(2026, 10, 18, 9, 30, 0, 123456000, time.FixedZone("CST", 8*3600))
+	cases := []struct {
+		field Field
+		want  string
+	}{
+		{String("s", "abc"), "s=abc"},
+		{String("s", "two words"), `s="two words"`},
+		{String("s", `a"b`), `s="a\"b"`},
+		{String("s", "k=v"), `s="k=v"`},
+		{String("s", "line\n"), `s="line\n"`},
+		{String("s", ""), `s=""`},
+		{Int("i", -42), "i=-42"},
+		{Int64("i64", math.MinInt64), "i64=-9223372036854775808"},
+		{Float64("f", 1.5), "f=1.5"},
+		{Float64("f", 1e21), "f=1e+21"},
+		{Float64("f", math.NaN()), "f=NaN"},
+		{Float64("f", math.Inf(-1)), "f=-Inf"},
+		{Bool("b", true), "b=true"},
+		{Bool("b", false), "b=false"},
+		{Duration("d", 1500*time.Millisecond), "d=1.5s"},
+		{Duration("d", 0), "d=0s"},
+		{Time("t", when), "t=2026-10-18T09:30:00.123456+08:00"},
+		{Err(errors.New("disk full")), `error="disk full"`},
+		{Err(nil), "error=<nil>"},
+		{Any("a", point{1, 2}), "a={1 2}"},
+		{Any("a", nil), "a=<nil>"},
+		{Field{Key: "u"}, "u=<unknown>"},
+	}
+	for _, c := range cases {
+		msg := NewLogMsg()
+		msg.appendFields([]Field{c.field})
+		if got := string(msg.GetBytes()); got != " "+c.want {
+			t.Errorf("got %q, want %q", got, " "+c.want)
+		}
+	}
+}
+
+func TestWithNested(t *testing.T) {
+	sink := &memorySink{}
+	logger := NewLogger(WithWriter(sink), WithPrintFileNameLineNo(false))
+	child := logger.With(String("req", "abc"))
+	grandchild := child.With(Int("user", 7), Bool("admin", false))
+	grandchild.Infow("hello", Duration("took", time.Second))
+	syncLogger(t, logger)
+
+	out := sink.String()
+	if !strings.Contains(out, "- req=abc user=7 admin=false hello took=1s\n") {
+		t.Fatalf("nested context = %q", out)
+	}
+}
+
+func TestWithLeavesParentUnchanged(t *testing.T) {
+	sink := &memorySink{}
+	logger := NewLogger(WithWriter(sink), WithPrintFileNameLineNo(false))
+	parent := logger.With(String("req", "abc"))
+	//两个子Logger 共享同一个父Logger的context，不能互相覆盖
+	a := parent.With(String("child", "a"))
+	b := parent.With(String("child", "b"))
+	if parent.With() != parent {
+		t.Fatal("With() without fields should return the same Logger")
+	}
+
+	logger.Infow("root")
+	parent.Infow("parent")
+	a.Infow("a")
+	b.Infow("b")
+	syncLogger(t, logger)
+
+	want := []string{"- root\n", "- req=abc parent\n", "- req=abc child=a a\n", "- req=abc child=b b\n"}
+	out := sink.String()
+	for _, w := range want {
+		if !strings.Contains(out, w) {
+			t.Errorf("missing %q in %q", w, out)
+		}
+	}
+	if strings.Count(out, "child=") != 2 {
+		t.Fatalf("child fields leaked into other loggers: %q", out)
+	}
+}
+
+func TestWithJSONContext(t *testing.T) {
+	sink := &memorySink{}
+	logger := NewLogger(WithWriter(sink), WithEncoder(NewJSONEncoder()))
+	logger.With(String("req", "abc")).With(Int("user", 7)).Infow("hello", Bool("ok", true))
+	syncLogger(t, logger)
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(sink.String()), &obj); err != nil {
+		t.Fatalf("invalid JSON %q: %v", sink.String(), err)
+	}
+	if obj["req"] != "abc" || obj["user"] != float64(7) || obj["ok"] != true || obj["msg"] != "hello" {
+		t.Fatalf("decoded %#v", obj)
+	}
+}
+
+//With之后 更换编码器：上下文字段 按新的编码器重新编码，不能把旧格式的字节 拼进新格式
+func TestWithThenSetEncoder(t *testing.T) {
+	sink := &memorySink{}
+	logger := NewLogger(WithWriter(sink), WithPrintFileNameLineNo(false))
+	child := logger.With(String("req", "abc"))
+	grandchild := child.With(Int("user", 7))
+	child.Infow("text")
+	if err := logger.SetEncoder(NewJSONEncoder()); err != nil {
+		t.Fatal(err)
+	}
+	child.Infow("json")
+	grandchild.Infow("json")
+	if err := logger.SetEncoder(NewTextEncoder()); err != nil {
+		t.Fatal(err)
+	}
+	grandchild.Infow("text again")
+	syncLogger(t, logger)
+
+	lines := strings.Split(strings.TrimSpace(sink.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("entries = %q", lines)
+	}
+	if !strings.HasSuffix(lines[0], "- req=abc text") || !strings.HasSuffix(lines[3], "- req=abc user=7 text again") {
+		t.Fatalf("text entries = %q", lines)
+	}
+	for i, want := range []map[string]interface{}{{"req": "abc"}, {"req": "abc", "user": float64(7)}} {
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(lines[i+1]), &obj); err != nil {
+			t.Fatalf("invalid JSON %q: %v", lines[i+1], err)
+		}
+		for k, v := range want {
+			if obj[k] != v {
+				t.Errorf("%s = %#v in %q", k, obj[k], lines[i+1])
+			}
+		}
+	}
+}
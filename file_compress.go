@@ -0,0 +1,143 @@
+package zlog
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//旧日志文件的压缩算法，例如gzip；zstd等 可由第三方包实现该接口
+type Compressor interface {
+	Ext() string //压缩文件的后缀，如 ".gz"
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+}
+
+type GzipCompressor struct {
+	Level int
+}
+
+func NewGzipCompressor(level int) *GzipCompressor {
+	return &GzipCompressor{Level: level}
+}
+
+func (c *GzipCompressor) Ext() string {
+	return ".gz"
+}
+
+func (c *GzipCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriterLevel(w, c.Level)
+}
+
+const compressTmpExt = ".tmp"
+
+//临时文件 超过这个时间没有修改，说明压缩它的进程 已经退出(压缩时 临时文件一直在写入)
+const compressTmpStale = 5 * time.Minute
+
+//压缩目录中 已关闭的日志文件(不含当前文件)，包括其他pid(上次运行，或 同一程序的另一个实例)的文件，
+//但不含 其他pid最新的.log文件：可能正在被写入，同removeOldFiles.
+//先写入临时文件 xxx.log.gz.tmp，再rename成 xxx.log.gz，最后删除原文件；
+//中断的压缩 留下的临时文件 在这里清理：对应的压缩文件已存在，或 临时文件 已经很久没有修改.
+func (fw *FileWriter) compressOldFiles(currentName string) error {
+	files, err := fw.oldLogFiles(currentName)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	ext := fw.config.Compressor.Ext()
+	othersNewest := make(map[int]bool)
+	for _, f := range files {
+		path := filepath.Join(fw.logFilePath, f.name)
+		switch f.suffix {
+		case ".log" + ext + compressTmpExt:
+			_, err := os.Stat(strings.TrimSuffix(path, compressTmpExt))
+			if err == nil || time.Since(f.modTime) > compressTmpStale {
+				os.Remove(path)
+			}
+		case ".log":
+			if f.pid != pid && !othersNewest[f.pid] {
+				othersNewest[f.pid] = true
+				continue
+			}
+			if err := fw.compressFile(f.name, ext); err != nil {
+				lastErr = err
+			}
+		}
+	}
+	return lastErr
+}
+
+func (fw *FileWriter) compressFile(name string, ext string) error {
+	src := filepath.Join(fw.logFilePath, name)
+	dst := src + ext
+	tmp := dst + compressTmpExt
+
+	//压缩文件已存在，说明上次rename之后 删除原文件前 被中断了
+	if _, err := os.Stat(dst); err == nil {
+		return removeIfExists(src)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil //已被 另一个实例 压缩或删除
+		}
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	//O_EXCL：同一程序的另一个实例 可能正在压缩同一个文件，临时文件已存在时 跳过
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fw.config.FileMode)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := fw.compressTo(in, out); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	//保留原文件的修改时间，保留策略(MaxAge)按它计算
+	os.Chtimes(dst, info.ModTime(), info.ModTime())
+	return removeIfExists(src)
+}
+
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (fw *FileWriter) compressTo(in io.Reader, out *os.File) error {
+	defer out.Close()
+
+	zw, err := fw.config.Compressor.NewWriter(out)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(zw, in); err != nil {
+		zw.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,86 @@
+package zlog
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+//当前日志文件的命名方式
+type FileNameMode int
+
+const (
+	//每个文件都以 日期-时间.basename.主机名.pid.log 命名
+	FileNameTimestamp FileNameMode = iota
+	//同上，另外维护一个 basename.log 符号链接，始终指向当前文件
+	FileNameSymlink
+	//始终写入 basename.log，切换时 将它重命名为 日期-时间.basename.主机名.pid.log
+	FileNameRename
+)
+
+//固定的当前文件名，便于 tail -F 和 日志采集程序跟踪
+func currentFileName() string {
+	return baseName + ".log"
+}
+
+//先建一个临时的符号链接，再rename覆盖，保证 basename.log 始终存在且指向有效的文件
+func (fw *FileWriter) updateSymlink(target string) error {
+	link := filepath.Join(fw.logFilePath, currentFileName())
+	//之前可能用的是 FileNameRename模式，先把 basename.log 改名，以免被覆盖
+	if info, err := os.Lstat(link); err == nil && info.Mode().IsRegular() && info.Size() > 0 {
+		fw.archiveCurrentFile(info.ModTime().In(fw.config.Location))
+	}
+
+	tmp := link + ".tmp" + strconv.Itoa(pid)
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+//将 basename.log 重命名为 带时间戳的文件名(时间为 该文件的打开时间)
+//目标文件已存在时(同一秒内多次切换)，时间戳顺延一秒
+func (fw *FileWriter) archiveCurrentFile(openTime time.Time) error {
+	current := filepath.Join(fw.logFilePath, currentFileName())
+	for i := 0; i < 60; i++ {
+		archived := filepath.Join(fw.logFilePath, timestampFileName(openTime.Add(time.Duration(i)*time.Second)))
+		if _, err := os.Lstat(archived); os.IsNotExist(err) {
+			return os.Rename(current, archived)
+		}
+	}
+	return os.ErrExist
+}
+
+//进程重启时，上一个进程留下的 basename.log：
+//仍在当前的时间周期内、且没有超过RollSize，则继续写入；否则 先重命名(时间取 文件的最后修改时间).
+func (fw *FileWriter) resumeCurrentFile(now time.Time) error {
+	info, err := os.Lstat(filepath.Join(fw.logFilePath, currentFileName()))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		//之前可能用的是 FileNameSymlink模式
+		return os.Remove(filepath.Join(fw.logFilePath, currentFileName()))
+	}
+	if info.Size() == 0 {
+		return nil
+	}
+
+	modTime := info.ModTime().In(fw.config.Location)
+	samePeriod := fw.config.RollPeriod <= 0 ||
+		nextPeriodBoundary(modTime, fw.config.RollPeriod, fw.config.Location).After(now)
+	underSize := fw.config.RollSize <= 0 || uint64(info.Size()) < fw.config.RollSize
+	if samePeriod && underSize {
+		return nil
+	}
+	return fw.archiveCurrentFile(modTime)
+}
@@ -0,0 +1,76 @@
+package zlog
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+//重新打开当前文件(路径不变)，配合系统的logrotate使用：
+//logrotate把文件改名之后，zlog 仍在写 改名后的inode，调用Reopen后 才会新建同名文件 继续写.
+//Reopen只做标记，真正的 flush、close、open 在 刷日志routine 中 两次写入之间执行.
+func (fw *FileWriter) Reopen() {
+	fw.reopenPending.Store(true)
+	if fw.logger != nil {
+		fw.logger.wakeup()
+	}
+}
+
+//收到信号(默认SIGHUP)时 调用Reopen，返回的函数用于 停止监听
+func (fw *FileWriter) ReopenOnSignal(sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sigs...)
+	go func() {
+		for {
+			select {
+			case <-ch:
+				fw.Reopen()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
+
+func (fw *FileWriter) checkReopen() error {
+	if fw.reopenPending.Swap(false) {
+		return fw.reopen()
+	}
+	return nil
+}
+
+func (fw *FileWriter) reopen() error {
+	if fw.file == nil {
+		return fw.Rotate()
+	}
+
+	path := fw.file.Name()
+	flushErr := fw.flushBuf()
+	fw.file.Close()
+	fw.file = nil
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, fw.config.FileMode)
+	if err != nil {
+		//没有写入的内容 优先交还给Logger，打开失败 下一次Write时 重试
+		if flushErr != nil {
+			return flushErr
+		}
+		return err
+	}
+	fw.file = file
+	fw.nbytes = 0
+	if info, err := file.Stat(); err == nil {
+		fw.nbytes = uint64(info.Size())
+	}
+	return flushErr
+}
@@ -0,0 +1,159 @@
+package zlog
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type logFileInfo struct {
+	name    string
+	pid     int    //写这个文件的进程
+	suffix  string //pid之后的后缀，见parseLogFileName
+	size    int64
+	modTime time.Time
+}
+
+//通知后台routine 压缩旧文件、按保留策略清理旧文件，不阻塞 刷日志routine
+func (fw *FileWriter) startMill(currentName string) {
+	if fw.config.MaxBackups <= 0 && fw.config.MaxAge <= 0 && fw.config.MaxTotalSize <= 0 &&
+		fw.config.Compressor == nil {
+		return
+	}
+	//Close()之后 millCh已关闭
+	if fw.closed {
+		return
+	}
+
+	fw.millOnce.Do(func() {
+		fw.millCh = make(chan string, 1)
+		go fw.millRun()
+	})
+
+	//只保留最新的一次通知
+	select {
+	case <-fw.millCh:
+	default:
+	}
+	fw.millCh <- currentName
+}
+
+func (fw *FileWriter) millRun() {
+	for currentName := range fw.millCh {
+		if fw.config.Compressor != nil {
+			fw.compressOldFiles(currentName)
+		}
+		fw.removeOldFiles(currentName)
+	}
+}
+
+func (fw *FileWriter) removeOldFiles(currentName string) error {
+	files, err := fw.oldLogFiles(currentName)
+	if err != nil {
+		return err
+	}
+
+	var totalSize int64
+	if info, err := os.Stat(filepath.Join(fw.logFilePath, currentName)); err == nil {
+		totalSize = info.Size()
+	}
+
+	var lastErr error
+	now := fw.config.Clock()
+	backups := 0
+	othersNewest := make(map[int]bool) //其他pid 是否已经遇到过 最新的.log文件
+	for _, f := range files {
+		//正在压缩的临时文件 不计入
+		if strings.HasSuffix(f.name, compressTmpExt) {
+			continue
+		}
+		//其他pid(同一程序的另一个实例，或 上次运行)最新的.log文件 可能正在被写入，不删除，也不计入
+		//它们更旧的文件 已经切换过，按保留策略处理，否则 每次重启后 旧文件就不再被清理
+		if f.pid != pid && f.suffix == ".log" && !othersNewest[f.pid] {
+			othersNewest[f.pid] = true
+			continue
+		}
+		totalSize += f.size
+		remove := (fw.config.MaxBackups > 0 && backups >= fw.config.MaxBackups) ||
+			(fw.config.MaxAge > 0 && now.Sub(f.modTime) > fw.config.MaxAge) ||
+			(fw.config.MaxTotalSize > 0 && totalSize > fw.config.MaxTotalSize)
+		if remove {
+			if err := os.Remove(filepath.Join(fw.logFilePath, f.name)); err != nil && !os.IsNotExist(err) {
+				lastErr = err
+			}
+		}
+		backups++
+	}
+	return lastErr
+}
+
+//目录中 本程序的旧日志文件(不含当前文件，包括其他pid的文件)，按文件名中的时间 从新到旧排序
+func (fw *FileWriter) oldLogFiles(currentName string) ([]logFileInfo, error) {
+	entries, err := os.ReadDir(fw.logFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]logFileInfo, 0, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		if name == currentName || !e.Type().IsRegular() {
+			continue
+		}
+		filePid, suffix := parseLogFileName(name)
+		if suffix == "" {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, logFileInfo{name: name, pid: filePid, suffix: suffix, size: info.Size(), modTime: info.ModTime()})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].name > files[j].name
+	})
+	return files, nil
+}
+
+//文件名格式：日期-时间.basename.主机名.pid.log，例如 20160609-221710.file_demo.host.27204.log
+//是本程序的日志文件时，返回文件名中的pid 和 pid之后的后缀(.log，压缩后的 .log.gz，压缩中的 .log.gz.tmp)，否则后缀为空串
+//同一个程序 可能有多个实例 写同一个目录(或 上次运行留下的文件)，pid不同的文件 不属于当前的FileWriter
+func parseLogFileName(name string) (int, string) {
+	if len(name) < 16 || name[8] != '-' || name[15] != '.' {
+		return 0, ""
+	}
+	if !isDigits(name[0:8]) || !isDigits(name[9:15]) {
+		return 0, ""
+	}
+
+	rest := name[16:]
+	prefix := baseName + "." + hostName + "."
+	if !strings.HasPrefix(rest, prefix) {
+		return 0, ""
+	}
+	rest = rest[len(prefix):]
+
+	dot := strings.IndexByte(rest, '.')
+	if dot <= 0 || !isDigits(rest[:dot]) || !strings.HasPrefix(rest[dot:], ".log") {
+		return 0, ""
+	}
+	filePid, err := strconv.Atoi(rest[:dot])
+	if err != nil {
+		return 0, ""
+	}
+	return filePid, rest[dot:]
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return len(s) > 0
+}
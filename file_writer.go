@@ -1,117 +1,182 @@
 package zlog
 
 import (
-	"bufio"
 	"errors"
 	"os"
 	"path/filepath"
-	"runtime"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type FileWriter struct {
-	logger        *Logger
-	bufWriter     *bufio.Writer
-	file          *os.File
-	nbytes        uint64 //当前已写入的字节数
-	startOfPeriod int64
-	count         int
-	logFilePath   string
+	logger         *Logger
+	config         FileWriterConfig
+	buf            []byte //写文件的缓冲区，尚未写入文件的内容；写入失败时 交还给Logger(见WriteError)，不丢弃
+	file           *os.File
+	nbytes         uint64    //当前文件的字节数，包括缓冲区中的
+	nextRotateTime time.Time //下一次按时间切换文件的时刻
+	openTime       time.Time //当前文件的打开时间，FileNameRename模式下 用于生成切换后的文件名
+	logFilePath    string
+	millCh         chan string //通知后台routine 清理旧文件，内容为当前文件名
+	millOnce       sync.Once
+	reopenPending  atomic.Bool //Reopen()设置，由 刷日志routine 在两次写入之间 执行
+	closed         bool        //Close()之后 不再写入，也不再切换文件
 }
 
 const (
-	rollSize          uint64 = 100 * 1024 * 1024
-	bufferSize               = 256 * 1024
-	rollPerSeconds           = 60 * 60 * 24
-	checkRotateEveryN        = 102400
+	DefaultRollSize   uint64 = 100 * 1024 * 1024
+	DefaultBufferSize        = 256 * 1024
+
+	RollHourly = time.Hour
+	RollDaily  = 24 * time.Hour
 )
 
+//FileWriter的配置项
+type FileWriterConfig struct {
+	RollSize   uint64           //文件大小超过RollSize时 切换文件，0表示不按大小切换
+	RollPeriod time.Duration    //按时间切换文件的周期(RollHourly, RollDaily，或自定义)，0表示不按时间切换；超过一天时 必须是整数天
+	BufferSize int              //写文件的缓冲区大小
+	FileMode   os.FileMode      //日志文件的权限
+	DirMode    os.FileMode      //日志目录的权限
+	Location   *time.Location   //按时间切换文件时，周期的边界按该时区的本地时间对齐(默认time.Local)
+	Clock      func() time.Time //获取当前时间(默认time.Now)，测试时可替换
+
+	//旧日志文件的保留策略，每次切换文件后 在后台执行，0表示不限制
+	//只处理本程序的日志文件(日期-时间.basename.主机名.pid.log)，同一目录下 其他程序的文件不受影响
+	MaxBackups   int           //最多保留的旧文件个数
+	MaxAge       time.Duration //旧文件 最后修改时间 超过MaxAge 则删除
+	MaxTotalSize int64         //目录中 本程序日志文件的总大小上限(含当前文件)，超过时 从最旧的文件开始删除
+
+	//切换文件后 在后台压缩旧文件，nil表示不压缩，例如 NewGzipCompressor(gzip.DefaultCompression)
+	Compressor Compressor
+
+	//当前文件的命名方式，默认每个文件名都带时间戳
+	FileNameMode FileNameMode
+}
+
+func DefaultFileWriterConfig() FileWriterConfig {
+	return FileWriterConfig{
+		RollSize:   DefaultRollSize,
+		RollPeriod: RollDaily,
+		BufferSize: DefaultBufferSize,
+		FileMode:   0644,
+		DirMode:    0755,
+	}
+}
+
 func NewFileWriter(logger *Logger, filePath string) (*FileWriter, error) {
+	return NewFileWriterWithConfig(logger, filePath, DefaultFileWriterConfig())
+}
+
+func NewFileWriterWithConfig(logger *Logger, filePath string, config FileWriterConfig) (*FileWriter, error) {
+	//周期的边界 按本地零点对齐，超过一天又不是整数天的周期(如36h) 无法对齐
+	if config.RollPeriod > RollDaily && config.RollPeriod%RollDaily != 0 {
+		return nil, errors.New("zlog: RollPeriod " + config.RollPeriod.String() + " is longer than a day but not a whole number of days")
+	}
+	defaults := DefaultFileWriterConfig()
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaults.BufferSize
+	}
+	if config.FileMode == 0 {
+		config.FileMode = defaults.FileMode
+	}
+	if config.DirMode == 0 {
+		config.DirMode = defaults.DirMode
+	}
+	if config.Location == nil {
+		config.Location = time.Local
+	}
+	if config.Clock == nil {
+		config.Clock = time.Now
+	}
+
 	fw := &FileWriter{}
 	fw.logger = logger
+	fw.config = config
 	fw.logFilePath = filePath
+	fw.buf = make([]byte, 0, config.BufferSize)
 
 	//判断路径是否存在，如果不存在，则创建
-	if err := os.MkdirAll(filePath, 0755); err != nil {
+	if err := os.MkdirAll(filePath, config.DirMode); err != nil {
 		if !os.IsExist(err) {
 			return nil, errors.New("filePath:" + filePath + " create failed!")
 		}
 	}
 
-	fw.Rotate()
+	if err := fw.Rotate(); err != nil {
+		return nil, err
+	}
 	return fw, nil
 }
 
-func (fw *FileWriter) formatHeader(level LogLevel, isPrintFileName bool) *LogMsg {
-	msg := recordPool.Get().(*LogMsg)
+//切换到新文件，出错时 返回第一个错误
+//新文件打开失败时，下一次Write会重试；Close()之后 返回os.ErrClosed
+func (fw *FileWriter) Rotate() error {
+	if fw.closed {
+		return os.ErrClosed
+	}
+	now := fw.config.Clock().In(fw.config.Location)
 
-	// 手动组装日志串，而不是用Sprintf，因为Sprintf比较耗时.
-	//组装日志串的格式：
-	//日期    时间.微秒    pid   日志级别  源文件名：行号：函数名 -   正文
-	now := time.Now()
-	year, month, day := now.Date()
-	hour, minute, second := now.Clock()
-	msg.fourDigits(0, year)
-	msg.twoDigits(4, int(month))
-	msg.twoDigits(6, day)
-	msg.logContent[8] = ' '
-	msg.twoDigits(9, hour)
-	msg.logContent[11] = ':'
-	msg.twoDigits(12, minute)
-	msg.logContent[14] = ':'
-	msg.twoDigits(15, second)
-	msg.logContent[17] = '.'
-	msg.nDigits(6, 18, now.Nanosecond()/1000, '0')
-	msg.logContent[24] = ' '
-	msg.nDigits(7, 25, pid, ' ')
-	msg.logContent[32] = ' '
-	msg.writeIndex = 33
-	msg.appendString(LEVEL_FLAGS[level])
-
-	if isPrintFileName {
-		//获取源文件名，行号，函数名
-		var funcName string
-		pc, file, line, ok := runtime.Caller(3)
-		if ok {
-			slash := strings.LastIndex(file, "/")
-			if slash >= 0 {
-				file = file[slash+1:]
-			}
-
-			funcPtr := runtime.FuncForPC(pc)
-			if funcPtr != nil {
-				funcName = funcPtr.Name()
-			}
-		} else {
-			file = "NoneFileName"
-			line = 1
-			funcName = "NoneFuncName"
+	var firstErr error
+	keepErr := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
 		}
-		msg.appendString(" " + file + ":")
-		msg.appendInt(line)
-		msg.appendString(":" + funcName + " - ")
-	} else {
-		msg.appendString(" - ")
 	}
-	return msg
-}
 
-func (fw *FileWriter) Rotate() error {
 	if fw.file != nil {
-		fw.Flush()
-		fw.file.Close()
+		keepErr(fw.flushBuf())
+		keepErr(fw.file.Close())
+		fw.file = nil
+		if fw.config.FileNameMode == FileNameRename {
+			keepErr(fw.archiveCurrentFile(fw.openTime))
+		}
+	} else if fw.config.FileNameMode == FileNameRename {
+		//启动时，处理上一个进程留下的 basename.log
+		keepErr(fw.resumeCurrentFile(now))
 	}
 
-	//不用fmt.Sprintf，手动组装文件名
-	//文件名格式：日期-时间.basename.主机名.pid.log
+	var fileName string
+	if fw.config.FileNameMode == FileNameRename {
+		fileName = currentFileName()
+	} else {
+		fileName = fw.unusedTimestampFileName(now)
+	}
+	tmpfilepath := filepath.Join(fw.logFilePath, fileName)
+
+	if file, err := os.OpenFile(tmpfilepath, os.O_RDWR|os.O_CREATE|os.O_APPEND, fw.config.FileMode); err == nil {
+		fw.file = file
+	} else {
+		keepErr(err)
+		return firstErr
+	}
+
+	fw.nbytes = 0
+	if info, err := fw.file.Stat(); err == nil {
+		fw.nbytes = uint64(info.Size()) //续写已有的文件
+	}
+	fw.openTime = now
+	if fw.config.RollPeriod > 0 {
+		fw.nextRotateTime = nextPeriodBoundary(now, fw.config.RollPeriod, fw.config.Location)
+	}
+
+	if fw.config.FileNameMode == FileNameSymlink {
+		keepErr(fw.updateSymlink(fileName))
+	}
+	fw.startMill(fileName)
+	return firstErr
+}
+
+//不用fmt.Sprintf，手动组装文件名
+//文件名格式：日期-时间.basename.主机名.pid.log
+func timestampFileName(now time.Time) string {
 	fileName := recordPool.Get().(*LogMsg)
 	defer func() {
 		fileName.Clear()
 		recordPool.Put(fileName)
 	}()
 
-	now := time.Now()
 	year, month, day := now.Date()
 	hour, minute, second := now.Clock()
 	fileName.fourDigits(0, year)
@@ -126,45 +191,202 @@ func (fw *FileWriter) Rotate() error {
 	fileName.appendString(baseName + "." + hostName + ".")
 	fileName.appendInt(pid)
 	fileName.appendString(".log")
+	return string(fileName.GetBytes())
+}
 
-	tmpfilepath := filepath.Join(fw.logFilePath, string(fileName.GetBytes()))
+//切换到的文件已存在时(同一秒内 按大小多次切换)，时间戳顺延一秒，同archiveCurrentFile；
+//否则 会续写同一个文件，它已超过RollSize，之后 每次写入都会再切换
+func (fw *FileWriter) unusedTimestampFileName(now time.Time) string {
+	for i := 0; i < 60; i++ {
+		name := timestampFileName(now.Add(time.Duration(i) * time.Second))
+		if _, err := os.Lstat(filepath.Join(fw.logFilePath, name)); os.IsNotExist(err) {
+			return name
+		}
+	}
+	return timestampFileName(now)
+}
 
-	if file, err := os.OpenFile(tmpfilepath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644); err == nil {
-		fw.file = file
+func (fw *FileWriter) Write(content []byte) error {
+	if fw.closed {
+		return os.ErrClosed
+	}
+	if err := fw.checkReopen(); err != nil {
+		return notWritten(err, content)
+	}
+	//上次打开文件失败了，重试
+	if fw.file == nil {
+		if err := fw.Rotate(); err != nil {
+			return notWritten(err, content)
+		}
+	}
+
+	//缓冲区放不下时 先写出缓冲区
+	if len(fw.buf)+len(content) > cap(fw.buf) {
+		if err := fw.flushBuf(); err != nil {
+			return notWritten(err, content)
+		}
+	}
+	if len(content) >= cap(fw.buf) {
+		//比缓冲区还大，直接写入文件
+		n, err := fw.file.Write(content)
+		fw.nbytes += uint64(n)
+		if err != nil {
+			return &WriteError{Err: err, Unwritten: append([]byte(nil), content[n:]...)}
+		}
 	} else {
-		return err
+		fw.buf = append(fw.buf, content...)
+		fw.nbytes += uint64(len(content))
 	}
 
-	fw.nbytes = 0
-	fw.startOfPeriod = now.Unix() / rollPerSeconds * rollPerSeconds
-	fw.count = 0
+	//content已经写入，之后切换文件出错时 不能让Logger把content再写一遍
+	var err error
+	if fw.config.RollSize > 0 && fw.nbytes >= fw.config.RollSize {
+		err = fw.Rotate()
+	} else {
+		err = fw.checkRotatePeriod(fw.config.Clock())
+	}
+	if err != nil {
+		var werr *WriteError
+		if !errors.As(err, &werr) {
+			err = &WriteError{Err: err}
+		}
+	}
+	return err
+}
 
-	if fw.bufWriter = bufio.NewWriterSize(fw.file, bufferSize); fw.bufWriter == nil {
-		return errors.New("new fileBufWriter failed.")
+//把缓冲区写入文件. 失败时 清空缓冲区(磁盘恢复后 能继续写)，没有写入的内容 放在返回的*WriteError中
+func (fw *FileWriter) flushBuf() error {
+	if len(fw.buf) == 0 || fw.file == nil {
+		return nil
 	}
+	n, err := fw.file.Write(fw.buf)
+	if err != nil {
+		unwritten := append([]byte(nil), fw.buf[n:]...)
+		fw.nbytes -= uint64(len(unwritten))
+		fw.buf = fw.buf[:0]
+		return &WriteError{Err: err, Unwritten: unwritten}
+	}
+	fw.buf = fw.buf[:0]
+	return nil
+}
+
+//content没有写入：加到错误的Unwritten之后；其他错误 Logger本来就认为content没有写入
+func notWritten(err error, content []byte) error {
+	var werr *WriteError
+	if errors.As(err, &werr) {
+		werr.Unwritten = append(werr.Unwritten, content...)
+	}
+	return err
+}
 
+//到了时间周期的边界，就切换文件
+//Flush在 刷日志routine中 定期调用，所以没有日志写入时 也能按时切换
+func (fw *FileWriter) checkRotatePeriod(now time.Time) error {
+	if !fw.nextRotateTime.IsZero() && !now.Before(fw.nextRotateTime) {
+		return fw.Rotate()
+	}
 	return nil
 }
 
-func (fw *FileWriter) Write(content []byte) error {
-	n, _ := fw.bufWriter.Write(content)
-	fw.nbytes += uint64(n)
+func (fw *FileWriter) Flush() error {
+	if fw.closed {
+		return nil
+	}
+	if err := fw.checkReopen(); err != nil {
+		return err
+	}
+	if err := fw.flushBuf(); err != nil {
+		return err
+	}
+	return fw.checkRotatePeriod(fw.config.Clock())
+}
+
+//刷出缓存，并把文件内容落盘(fsync)，Fatal日志之后 由 刷日志routine 调用
+func (fw *FileWriter) Sync() error {
+	if err := fw.Flush(); err != nil {
+		return err
+	}
+	if fw.file == nil {
+		return nil
+	}
+	return fw.file.Sync()
+}
+
+//刷出缓存，关闭当前文件，之后的Write 返回os.ErrClosed
+//Logger.SetWriter()和Logger.Close() 在 刷日志routine 中调用
+func (fw *FileWriter) Close() error {
+	if fw.closed {
+		return nil
+	}
+	fw.closed = true
+
+	var err error
+	if fw.file != nil {
+		err = fw.flushBuf()
+		if cerr := fw.file.Close(); err == nil {
+			err = cerr
+		}
+		fw.file = nil
+	}
 
-	if fw.nbytes >= rollSize {
-		fw.Rotate()
+	//后台清理routine 处理完最后一次通知后退出
+	fw.millOnce.Do(func() {})
+	if fw.millCh != nil {
+		close(fw.millCh)
+	}
+	return err
+}
+
+//计算t所在周期的结束时刻(即下一个周期的开始)，按loc的本地时间(墙上时间)对齐：
+//周期为整数天时，边界是本地的零点；小于一天时，边界是 从本地零点开始 每隔一个周期的时刻.
+//夏令时切换的那天 按墙上时间对齐(那天可能是23或25小时).
+func nextPeriodBoundary(t time.Time, period time.Duration, loc *time.Location) time.Time {
+	t = t.In(loc)
+	year, month, day := t.Date()
+
+	var next time.Time
+	if period%RollDaily == 0 {
+		//从1970-01-01(本地日历)起的天数，按周期的天数对齐
+		days := int(period / RollDaily)
+		n := int(time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix() / 86400)
+		next = localWallTime(1970, 1, 1+n-n%days+days, 0, loc)
 	} else {
-		fw.count++
-		if fw.count > checkRotateEveryN {
-			fw.count = 0
-			thisPeriod := time.Now().Unix() / rollPerSeconds * rollPerSeconds
-			if thisPeriod != fw.startOfPeriod {
-				fw.Rotate()
-			}
+		hour, minute, second := t.Clock()
+		wall := time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute +
+			time.Duration(second)*time.Second + time.Duration(t.Nanosecond())
+		wall = wall - wall%period + period
+		if wall >= RollDaily {
+			next = localWallTime(year, month, day+1, 0, loc)
+		} else {
+			next = localWallTime(year, month, day, wall, loc)
 		}
 	}
-	return nil
+
+	//墙上时间回拨时 可能算出t之前的时刻，保证边界一定在t之后
+	if !next.After(t) {
+		next = t.Add(period)
+	}
+	return next
 }
 
-func (fw *FileWriter) Flush() {
-	fw.bufWriter.Flush()
+//某天 本地墙上时间wall 对应的时刻
+//若该时刻落在 夏令时跳过的区间里(如 02:30 不存在)，取 时钟跳变的时刻
+func localWallTime(year int, month time.Month, day int, wall time.Duration, loc *time.Location) time.Time {
+	//按 时:分:秒 传入，int(wall)纳秒 在32位平台上会溢出
+	hour, minute := int(wall/time.Hour), int(wall%time.Hour/time.Minute)
+	second, nsec := int(wall%time.Minute/time.Second), int(wall%time.Second)
+	t := time.Date(year, month, day, hour, minute, second, nsec, loc)
+
+	want := time.Date(year, month, day, hour, minute, second, nsec, time.UTC)
+	got := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	if got.Before(want) {
+		if _, end := t.ZoneBounds(); !end.IsZero() {
+			t = end
+		}
+	} else if got.After(want) {
+		if start, _ := t.ZoneBounds(); !start.IsZero() {
+			t = start
+		}
+	}
+	return t
 }
@@ -0,0 +1,575 @@
+package zlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestNextPeriodBoundaryLocalMidnight(t *testing.T) {
+	//UTC+8的零点 是UTC的16点，而不是UTC的零点
+	loc := time.FixedZone("UTC+8", 8*3600)
+	now := time.Date(2026, 10, 18, 7, 0, 0, 0, time.UTC)
+
+	next := nextPeriodBoundary(now, RollDaily, loc)
+	want := time.Date(2026, 10, 18, 16, 0, 0, 0, time.UTC)
+	if !next.Equal(want) {
+		t.Fatalf("daily boundary = %v, want %v", next, want)
+	}
+
+	next = nextPeriodBoundary(now, RollHourly, loc)
+	want = time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)
+	if !next.Equal(want) {
+		t.Fatalf("hourly boundary = %v, want %v", next, want)
+	}
+}
+
+func TestNextPeriodBoundaryDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no tzdata:", err)
+	}
+
+	//2026-03-08 02:00 EST 跳到 03:00 EDT，这一天只有23小时
+	now := time.Date(2026, 3, 8, 12, 0, 0, 0, loc)
+	next := nextPeriodBoundary(now, RollDaily, loc)
+	want := time.Date(2026, 3, 9, 0, 0, 0, 0, loc)
+	if !next.Equal(want) {
+		t.Fatalf("daily boundary = %v, want %v", next, want)
+	}
+	if d := next.Sub(time.Date(2026, 3, 8, 0, 0, 0, 0, loc)); d != 23*time.Hour {
+		t.Fatalf("spring-forward day length = %v, want 23h", d)
+	}
+
+	now = time.Date(2026, 3, 8, 1, 30, 0, 0, loc)
+	next = nextPeriodBoundary(now, RollHourly, loc)
+	if d := next.Sub(now); d != 30*time.Minute {
+		t.Fatalf("hourly boundary across spring-forward = %v (+%v), want +30m", next, d)
+	}
+
+	//2026-11-01 02:00 EDT 回拨到 01:00 EST，这一天有25小时
+	now = time.Date(2026, 11, 1, 12, 0, 0, 0, loc)
+	next = nextPeriodBoundary(now, RollDaily, loc)
+	if d := next.Sub(time.Date(2026, 11, 1, 0, 0, 0, 0, loc)); d != 25*time.Hour {
+		t.Fatalf("fall-back day length = %v, want 25h", d)
+	}
+}
+
+func TestNextPeriodBoundaryCustom(t *testing.T) {
+	now := time.Date(2026, 10, 18, 10, 17, 0, 0, time.UTC)
+	next := nextPeriodBoundary(now, 15*time.Minute, time.UTC)
+	want := time.Date(2026, 10, 18, 10, 30, 0, 0, time.UTC)
+	if !next.Equal(want) {
+		t.Fatalf("15m boundary = %v, want %v", next, want)
+	}
+
+	next = nextPeriodBoundary(now, 2*RollDaily, time.UTC)
+	if !next.After(now) || next.Sub(now) > 2*RollDaily || next.Hour() != 0 {
+		t.Fatalf("2-day boundary = %v", next)
+	}
+}
+
+func TestRollPeriodMustBeWholeDays(t *testing.T) {
+	for _, period := range []time.Duration{36 * time.Hour, RollDaily + time.Minute, 3*RollDaily - time.Second} {
+		cfg := DefaultFileWriterConfig()
+		cfg.RollPeriod = period
+		if fw, err := NewFileWriterWithConfig(nil, t.TempDir(), cfg); err == nil {
+			fw.Close()
+			t.Errorf("RollPeriod %v accepted", period)
+		}
+	}
+	for _, period := range []time.Duration{7 * time.Hour, RollDaily, 3 * RollDaily} {
+		cfg := DefaultFileWriterConfig()
+		cfg.RollPeriod = period
+		fw, err := NewFileWriterWithConfig(nil, t.TempDir(), cfg)
+		if err != nil {
+			t.Errorf("RollPeriod %v rejected: %v", period, err)
+			continue
+		}
+		fw.Close()
+	}
+}
+
+func TestFileWriterRotatesOnPeriodWithoutWrites(t *testing.T) {
+	dir := t.TempDir()
+	loc := time.FixedZone("UTC+8", 8*3600)
+	now := time.Date(2026, 10, 18, 23, 59, 0, 0, loc)
+
+	cfg := DefaultFileWriterConfig()
+	cfg.Location = loc
+	cfg.Clock = func() time.Time { return now }
+	fw, err := NewFileWriterWithConfig(nil, dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte("before midnight\n"))
+	fw.Flush()
+	if n := countFiles(t, dir); n != 1 {
+		t.Fatalf("files before midnight = %d, want 1", n)
+	}
+
+	//没有写入，只有 刷日志routine 定期调用Flush
+	now = now.Add(2 * time.Minute)
+	fw.Flush()
+	if n := countFiles(t, dir); n != 2 {
+		t.Fatalf("files after midnight = %d, want 2", n)
+	}
+	if fw.nextRotateTime.In(loc).Day() != 20 || fw.nextRotateTime.In(loc).Hour() != 0 {
+		t.Fatalf("next rotate time = %v", fw.nextRotateTime.In(loc))
+	}
+}
+
+func countFiles(t *testing.T, dir string) int {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(entries)
+}
+
+func TestRemoveOldFilesKeepsOtherPrograms(t *testing.T) {
+	dir := t.TempDir()
+	own := func(ts string, pid int) string {
+		return ts + "." + baseName + "." + hostName + "." + strconv.Itoa(pid) + ".log"
+	}
+	names := []string{
+		own("20261017-000000", pid+1), //另一个实例 正在写的文件
+		own("20261016-000000", pid+2), //另一个实例 正在写的文件
+		own("20261015-000000", pid+2), //另一个实例 已切换的旧文件，计入保留策略
+		own("20261014-000000", pid),
+		own("20261013-000000", pid),
+		"20261012-000000.other_program." + hostName + ".100.log",
+		"app.log",
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := DefaultFileWriterConfig()
+	cfg.MaxBackups = 1
+	cfg.MaxAge = time.Nanosecond //其他pid最新的文件 即使过期 也不删除
+	fw, err := NewFileWriterWithConfig(nil, dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := filepath.Base(fw.file.Name())
+	if err := fw.removeOldFiles(current); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{current, names[0], names[1], names[5], names[6]} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s should be kept: %v", name, err)
+		}
+	}
+	for _, name := range names[2:5] {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s should be removed", name)
+		}
+	}
+}
+
+func TestCompressOldFiles(t *testing.T) {
+	dir := t.TempDir()
+	name := func(ts string, pid int, ext string) string {
+		return ts + "." + baseName + "." + hostName + "." + strconv.Itoa(pid) + ".log" + ext
+	}
+	write := func(n string) {
+		os.WriteFile(filepath.Join(dir, n), []byte("old log line\n"), 0644)
+	}
+	old := name("20261017-000000", pid, "")
+	//上次运行(pid不同，已崩溃)：切换过的文件 和 中断的压缩留下的临时文件
+	crashed := pid + 2
+	crashedOld := name("20261016-000000", crashed, "")
+	crashedNewest := name("20261016-120000", crashed, "")
+	staleTmp := name("20261015-000000", crashed, ".gz.tmp")
+	doneTmp := name("20261014-000000", crashed, ".gz.tmp") //压缩文件已存在，rename之后 被中断
+	//另一个实例(pid不同) 正在写的文件 和 正在压缩的临时文件
+	otherActive := name("20261017-120000", pid+1, "")
+	otherTmp := name("20261016-000000", pid+1, ".gz.tmp")
+	for _, n := range []string{old, crashedOld, crashedNewest, staleTmp, doneTmp, strings.TrimSuffix(doneTmp, ".tmp"), otherActive, otherTmp} {
+		write(n)
+	}
+	longAgo := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(dir, staleTmp), longAgo, longAgo)
+
+	cfg := DefaultFileWriterConfig()
+	cfg.Compressor = NewGzipCompressor(gzip.BestSpeed)
+	fw, err := NewFileWriterWithConfig(nil, dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fw.Close()
+
+	//压缩在后台routine中进行
+	removed := []string{old, crashedOld, staleTmp, doneTmp}
+	for i := 0; i < 100; i++ {
+		gone := 0
+		for _, n := range removed {
+			if _, err := os.Stat(filepath.Join(dir, n)); os.IsNotExist(err) {
+				gone++
+			}
+		}
+		if gone == len(removed) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, n := range removed {
+		if _, err := os.Stat(filepath.Join(dir, n)); !os.IsNotExist(err) {
+			t.Errorf("%s should be removed", n)
+		}
+	}
+	for _, n := range []string{crashedNewest, otherActive, otherTmp} {
+		if _, err := os.Stat(filepath.Join(dir, n)); err != nil {
+			t.Errorf("%s may still be in use and should be left alone: %v", n, err)
+		}
+	}
+	for _, n := range []string{crashedNewest, otherActive} {
+		if _, err := os.Stat(filepath.Join(dir, n+".gz")); !os.IsNotExist(err) {
+			t.Errorf("%s should not be compressed", n)
+		}
+	}
+
+	for _, n := range []string{old, crashedOld} {
+		f, err := os.Open(filepath.Join(dir, n+".gz"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(zr)
+		f.Close()
+		if string(content) != "old log line\n" {
+			t.Fatalf("decompressed content of %s = %q", n, content)
+		}
+	}
+}
+
+func TestFileNameModeRename(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 10, 18, 23, 59, 0, 0, time.UTC)
+	cfg := DefaultFileWriterConfig()
+	cfg.Location = time.UTC
+	cfg.Clock = func() time.Time { return now }
+	cfg.FileNameMode = FileNameRename
+
+	fw, err := NewFileWriterWithConfig(nil, dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte("day 1\n"))
+	fw.Flush()
+
+	//重启后 仍在同一个周期内，继续写 basename.log
+	fw, err = NewFileWriterWithConfig(nil, dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte("day 1 again\n"))
+	fw.Flush()
+	if n := countFiles(t, dir); n != 1 {
+		t.Fatalf("files after restart = %d, want 1", n)
+	}
+
+	now = now.Add(2 * time.Minute)
+	fw.Flush()
+	archived := filepath.Join(dir, timestampFileName(time.Date(2026, 10, 18, 23, 59, 0, 0, time.UTC)))
+	content, err := os.ReadFile(archived)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "day 1\nday 1 again\n" {
+		t.Fatalf("archived content = %q", content)
+	}
+	if _, err := os.Stat(filepath.Join(dir, currentFileName())); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileNameModeSymlink(t *testing.T) {
+	dir := t.TempDir()
+	cfg := DefaultFileWriterConfig()
+	cfg.FileNameMode = FileNameSymlink
+	fw, err := NewFileWriterWithConfig(nil, dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := os.Readlink(filepath.Join(dir, currentFileName()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != filepath.Base(fw.file.Name()) {
+		t.Fatalf("symlink target = %s, want %s", target, filepath.Base(fw.file.Name()))
+	}
+}
+
+func TestFileWriterReopen(t *testing.T) {
+	dir := t.TempDir()
+	fw, err := NewFileWriterWithConfig(nil, dir, DefaultFileWriterConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := fw.file.Name()
+	fw.Write([]byte("before logrotate\n"))
+	fw.Flush()
+
+	//模拟logrotate的create模式：改名，然后通知重新打开
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	fw.Reopen()
+	fw.Write([]byte("after logrotate\n"))
+	fw.Flush()
+
+	for name, want := range map[string]string{path + ".1": "before logrotate\n", path: "after logrotate\n"} {
+		content, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != want {
+			t.Errorf("%s = %q, want %q", name, content, want)
+		}
+	}
+}
+
+func TestFileWriterClose(t *testing.T) {
+	dir := t.TempDir()
+	cfg := DefaultFileWriterConfig()
+	cfg.MaxBackups = 2 //启动后台清理routine，Close时 关闭millCh
+	fw, err := NewFileWriterWithConfig(nil, dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := fw.file.Name()
+	fw.Write([]byte("buffered line\n"))
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "buffered line\n" {
+		t.Fatalf("content after Close = %q", content)
+	}
+	if err := fw.Write([]byte("late\n")); err != os.ErrClosed {
+		t.Fatalf("Write after Close = %v, want os.ErrClosed", err)
+	}
+	//例如 Close之后 才收到SIGHUP
+	if err := fw.Rotate(); err != os.ErrClosed {
+		t.Fatalf("Rotate after Close = %v, want os.ErrClosed", err)
+	}
+}
+
+func TestFileWriterConfigDefaults(t *testing.T) {
+	fw, err := NewFileWriterWithConfig(nil, t.TempDir(), FileWriterConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fw.Close()
+
+	defaults := DefaultFileWriterConfig()
+	cfg := fw.config
+	if cfg.BufferSize != defaults.BufferSize || cfg.FileMode != defaults.FileMode || cfg.DirMode != defaults.DirMode ||
+		cfg.Location != time.Local || cfg.Clock == nil {
+		t.Fatalf("config defaults = %+v", cfg)
+	}
+	//零值的RollSize, RollPeriod 表示不切换
+	if cfg.RollSize != 0 || !fw.nextRotateTime.IsZero() {
+		t.Fatalf("RollSize = %d, nextRotateTime = %v", cfg.RollSize, fw.nextRotateTime)
+	}
+	if cap(fw.buf) != DefaultBufferSize {
+		t.Fatalf("buffer size = %d, want %d", cap(fw.buf), DefaultBufferSize)
+	}
+}
+
+func TestFileWriterConfigRollSizeAndModes(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs", "app")
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	cfg := FileWriterConfig{
+		RollSize:   100,
+		BufferSize: 4096,
+		FileMode:   0600,
+		DirMode:    0700,
+		Location:   time.UTC,
+		Clock:      func() time.Time { return now },
+	}
+	fw, err := NewFileWriterWithConfig(nil, dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cap(fw.buf) != 4096 {
+		t.Fatalf("buffer size = %d, want 4096", cap(fw.buf))
+	}
+
+	line := make([]byte, 60)
+	for i := range line {
+		line[i] = 'x'
+	}
+	line[59] = '\n'
+	for i := 0; i < 3; i++ {
+		now = now.Add(time.Second) //文件名精确到秒
+		if err := fw.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil || info.Mode().Perm() != 0700 {
+		t.Fatalf("dir mode = %v, %v", info, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//前两次写入 超过RollSize 后切换，第三次写入新文件
+	if len(entries) != 2 {
+		t.Fatalf("files = %v, want 2", entries)
+	}
+	for i, want := range []int64{120, 60} {
+		info, err := os.Stat(filepath.Join(dir, entries[i].Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != want || info.Mode().Perm() != 0600 {
+			t.Errorf("%s: size = %d, mode = %v, want %d bytes and 0600", entries[i].Name(), info.Size(), info.Mode().Perm(), want)
+		}
+	}
+}
+
+//磁盘写满时，已缓存 但没有写入文件的日志 都要交给Logger
+func openDevFull(t *testing.T) *os.File {
+	f, err := os.OpenFile("/dev/full", os.O_WRONLY, 0)
+	if err != nil {
+		t.Skip("no /dev/full:", err)
+	}
+	return f
+}
+
+func TestFileWriterReturnsUnwrittenContent(t *testing.T) {
+	cfg := DefaultFileWriterConfig()
+	cfg.BufferSize = 64
+	fw, err := NewFileWriterWithConfig(nil, t.TempDir(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.file.Close()
+	fw.file = openDevFull(t)
+
+	var want, got []byte
+	collect := func(err error) {
+		var werr *WriteError
+		if err != nil && !errors.As(err, &werr) {
+			t.Fatalf("error %v is not a *WriteError", err)
+		}
+		if werr != nil {
+			got = append(got, werr.Unwritten...)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		line := []byte("line " + strconv.Itoa(i) + " of the disk-full test\n")
+		want = append(want, line...)
+		collect(fw.Write(line))
+	}
+	collect(fw.Write(bytes.Repeat([]byte("x"), 100))) //比缓冲区大，直接写入文件
+	want = append(want, bytes.Repeat([]byte("x"), 100)...)
+	collect(fw.Flush())
+
+	if string(got) != string(want) {
+		t.Fatalf("unwritten content = %q, want %q", got, want)
+	}
+	if fw.nbytes != 0 {
+		t.Fatalf("nbytes = %d, unwritten bytes counted as written", fw.nbytes)
+	}
+}
+
+func TestDiskFullGoesToFallback(t *testing.T) {
+	fw, err := NewFileWriter(nil, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.file.Close()
+	fw.file = openDevFull(t)
+
+	fallback := &memorySink{}
+	logger := NewLogger(WithWriter(fw), WithFallback(fallback), WithFlushInterval(60), WithPrintFileNameLineNo(false))
+	for i := 0; i < 10; i++ {
+		logger.Infow("disk full", Int("i", i))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := logger.Sync(ctx); err == nil {
+		t.Fatal("Sync to /dev/full succeeded")
+	}
+
+	out := fallback.String()
+	for i := 0; i < 10; i++ {
+		if !strings.Contains(out, "disk full i="+strconv.Itoa(i)+"\n") {
+			t.Fatalf("fallback is missing entry %d: %q", i, out)
+		}
+	}
+	if logger.ErrorCount() == 0 {
+		t.Fatal("write error not counted")
+	}
+}
+
+//同一秒内 按大小多次切换，每次都要切换到新的文件，不能续写已超过RollSize的文件
+func TestRollSizeWithinOneSecond(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	cfg := DefaultFileWriterConfig()
+	cfg.RollSize = 100
+	cfg.RollPeriod = 0
+	cfg.Location = time.UTC
+	cfg.Clock = func() time.Time { return now }
+	fw, err := NewFileWriterWithConfig(nil, dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := []byte(strings.Repeat("x", 59) + "\n")
+	for i := 0; i < 20; i++ {
+		if err := fw.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fw.Close()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//每两次写入 切换一次
+	if len(entries) != 11 {
+		t.Fatalf("files = %d, want 11", len(entries))
+	}
+	var total int64
+	for _, e := range entries {
+		info, _ := e.Info()
+		if info.Size() > 120 {
+			t.Errorf("%s grew to %d bytes", e.Name(), info.Size())
+		}
+		total += info.Size()
+	}
+	if total != 20*60 {
+		t.Fatalf("total size = %d, want %d", total, 20*60)
+	}
+}
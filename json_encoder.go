@@ -0,0 +1,279 @@
+package zlog
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+//JSON格式的编码器，每条日志输出一个JSON对象，独占一行：
+//{"time":"2016-06-09T23:31:21.770367+08:00","level":"ERROR","pid":28599,"caller":"demo.go:33","func":"main.main","msg":"Hello","uid":1001}
+//各个key的名字可配置，设置为空串 则不输出该项.
+type JSONEncoder struct {
+	TimeKey    string
+	LevelKey   string
+	PidKey     string
+	SeqKey     string //分片多于一个时(WithShards) 才输出
+	CallerKey  string
+	FuncKey    string
+	MessageKey string
+	StackKey   string //调用栈，WithStackLevel的级别及以上 才输出
+	TimeLayout string
+}
+
+func NewJSONEncoder() *JSONEncoder {
+	return &JSONEncoder{
+		TimeKey:    "time",
+		LevelKey:   "level",
+		PidKey:     "pid",
+		SeqKey:     "seq",
+		CallerKey:  "caller",
+		FuncKey:    "func",
+		MessageKey: "msg",
+		StackKey:   "stack",
+		TimeLayout: fieldTimeLayout,
+	}
+}
+
+func (enc *JSONEncoder) EncodeEntry(msg *LogMsg, ent *Entry) {
+	msg.growByte('{')
+
+	if enc.TimeKey != "" {
+		msg.appendJSONKey(enc.TimeKey)
+		msg.growByte('"')
+		msg.setBytes(ent.Time.AppendFormat(msg.logContent[:msg.writeIndex], enc.TimeLayout))
+		msg.growByte('"')
+	}
+	if enc.LevelKey != "" {
+		msg.appendJSONKey(enc.LevelKey)
+		msg.growByte('"')
+		msg.growString(strings.TrimLeft(LEVEL_FLAGS[ent.Level], " "))
+		msg.growByte('"')
+	}
+	if enc.PidKey != "" {
+		msg.appendJSONKey(enc.PidKey)
+		msg.setBytes(strconv.AppendInt(msg.logContent[:msg.writeIndex], int64(pid), 10))
+	}
+	if enc.SeqKey != "" && ent.Seq != 0 {
+		msg.appendJSONKey(enc.SeqKey)
+		msg.setBytes(strconv.AppendUint(msg.logContent[:msg.writeIndex], ent.Seq, 10))
+	}
+	if ent.HasCaller {
+		if enc.CallerKey != "" {
+			msg.appendJSONKey(enc.CallerKey)
+			msg.growByte('"')
+			msg.appendJSONEscaped(ent.ShortFile())
+			msg.growByte(':')
+			msg.setBytes(strconv.AppendInt(msg.logContent[:msg.writeIndex], int64(ent.Line), 10))
+			msg.growByte('"')
+		}
+		if enc.FuncKey != "" {
+			msg.appendJSONKey(enc.FuncKey)
+			msg.appendJSONString(ent.Func)
+		}
+	}
+
+	//上下文字段 以逗号开头，若前面没有任何字段，去掉这个逗号
+	if len(ent.Context) > 0 {
+		if msg.lastByte() == '{' && ent.Context[0] == ',' {
+			msg.growBytes(ent.Context[1:])
+		} else {
+			msg.growBytes(ent.Context)
+		}
+	}
+
+	if enc.MessageKey != "" {
+		msg.appendJSONKey(enc.MessageKey)
+		msg.growByte('"')
+		msg.appendJSONEscapedBytes(ent.Message)
+		msg.growByte('"')
+	}
+
+	for i := range ent.Fields {
+		msg.appendJSONKey(ent.Fields[i].Key)
+		enc.appendFieldValue(msg, &ent.Fields[i])
+	}
+
+	if enc.StackKey != "" && len(ent.Stack) > 0 {
+		msg.appendJSONKey(enc.StackKey)
+		msg.appendJSONStack(ent.Stack)
+	}
+
+	msg.growByte('}')
+	msg.growByte('\n')
+}
+
+//With()的上下文字段：每个字段都以逗号开头，如 ,"req":"abc","tenant":"acme"
+func (enc *JSONEncoder) EncodeFields(msg *LogMsg, fields []Field) {
+	for i := range fields {
+		msg.growByte(',')
+		msg.appendJSONString(fields[i].Key)
+		msg.growByte(':')
+		enc.appendFieldValue(msg, &fields[i])
+	}
+}
+
+func (enc *JSONEncoder) appendFieldValue(msg *LogMsg, f *Field) {
+	switch f.Type {
+	case StringType:
+		msg.appendJSONString(f.String)
+	case Int64Type:
+		msg.setBytes(strconv.AppendInt(msg.logContent[:msg.writeIndex], f.Integer, 10))
+	case Float64Type:
+		//NaN和Inf不是合法的JSON数字，以字符串输出
+		value := math.Float64frombits(uint64(f.Integer))
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			msg.growByte('"')
+			msg.setBytes(strconv.AppendFloat(msg.logContent[:msg.writeIndex], value, 'g', -1, 64))
+			msg.growByte('"')
+		} else {
+			msg.setBytes(strconv.AppendFloat(msg.logContent[:msg.writeIndex], value, 'g', -1, 64))
+		}
+	case BoolType:
+		msg.setBytes(strconv.AppendBool(msg.logContent[:msg.writeIndex], f.Integer != 0))
+	case DurationType:
+		//以秒为单位的数字
+		msg.setBytes(strconv.AppendFloat(msg.logContent[:msg.writeIndex], time.Duration(f.Integer).Seconds(), 'f', -1, 64))
+	case TimeType:
+		msg.growByte('"')
+		msg.setBytes(f.timeValue().AppendFormat(msg.logContent[:msg.writeIndex], enc.TimeLayout))
+		msg.growByte('"')
+	case ErrorType:
+		if err, ok := f.Interface.(error); ok && err != nil {
+			msg.appendJSONString(err.Error())
+		} else {
+			msg.growString("null")
+		}
+	case AnyType:
+		//任意类型 交给encoding/json，失败时 退化为字符串
+		if b, err := json.Marshal(f.Interface); err == nil {
+			msg.growBytes(b)
+		} else {
+			msg.appendJSONString(err.Error())
+		}
+	default:
+		msg.growString("null")
+	}
+}
+
+func (log *LogMsg) lastByte() byte {
+	if log.writeIndex == 0 {
+		return 0
+	}
+	return log.logContent[log.writeIndex-1]
+}
+
+//对象的第一个key前面不加逗号
+func (log *LogMsg) appendJSONKey(key string) {
+	if log.lastByte() != '{' {
+		log.growByte(',')
+	}
+	log.appendJSONString(key)
+	log.growByte(':')
+}
+
+func (log *LogMsg) appendJSONString(value string) {
+	log.growByte('"')
+	log.appendJSONEscaped(value)
+	log.growByte('"')
+}
+
+//手动转义，而不是用encoding/json，避免反射和内存分配.
+//只有 引号、反斜杠、控制字符、非法UTF-8、U+2028/U+2029 需要转义，其余字节 整段拷贝.
+func (log *LogMsg) appendJSONEscaped(value string) {
+	start := 0
+	for i := 0; i < len(value); {
+		c := value[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			log.growString(value[start:i])
+			log.appendJSONEscapedByte(c)
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(value[i:])
+		if r == utf8.RuneError && size == 1 {
+			log.growString(value[start:i])
+			log.growString(`\ufffd`)
+			i++
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			log.growString(value[start:i])
+			log.growString(`\u202`)
+			log.growByte(hexDigits[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	log.growString(value[start:])
+}
+
+//与appendJSONEscaped相同，参数为[]byte (避免string与[]byte之间转换的内存分配)
+func (log *LogMsg) appendJSONEscapedBytes(value []byte) {
+	start := 0
+	for i := 0; i < len(value); {
+		c := value[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			log.growBytes(value[start:i])
+			log.appendJSONEscapedByte(c)
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRune(value[i:])
+		if r == utf8.RuneError && size == 1 {
+			log.growBytes(value[start:i])
+			log.growString(`\ufffd`)
+			i++
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			log.growBytes(value[start:i])
+			log.growString(`\u202`)
+			log.growByte(hexDigits[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	log.growBytes(value[start:])
+}
+
+const hexDigits = "0123456789abcdef"
+
+func (log *LogMsg) appendJSONEscapedByte(c byte) {
+	switch c {
+	case '"', '\\':
+		log.growByte('\\')
+		log.growByte(c)
+	case '\n':
+		log.growString(`\n`)
+	case '\r':
+		log.growString(`\r`)
+	case '\t':
+		log.growString(`\t`)
+	default:
+		log.growString(`\u00`)
+		log.growByte(hexDigits[c>>4])
+		log.growByte(hexDigits[c&0xF])
+	}
+}
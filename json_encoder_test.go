@@ -0,0 +1,148 @@
+package zlog
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func encodeJSON(t *testing.T, enc *JSONEncoder, ent *Entry) map[string]interface{} {
+	t.Helper()
+	msg := NewLogMsg()
+	enc.EncodeEntry(msg, ent)
+	line := msg.GetBytes()
+	if len(line) == 0 || line[len(line)-1] != '\n' {
+		t.Fatalf("entry does not end with a newline: %q", line)
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal(line, &obj); err != nil {
+		t.Fatalf("invalid JSON %q: %v", line, err)
+	}
+	return obj
+}
+
+func TestJSONEscapingRoundTrip(t *testing.T) {
+	cases := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"plain", "hello world", "hello world"},
+		{"quotes", `say "hi"`, `say "hi"`},
+		{"backslash", `C:\path\to`, `C:\path\to`},
+		{"whitespace controls", "tab\tnew\nline\rcr", "tab\tnew\nline\rcr"},
+		{"other controls", "\x00\x01\x1f\x7f", "\x00\x01\x1f\x7f"},
+		{"invalid utf8", "bad\xffutf8\xc3", "bad\ufffdutf8\ufffd"},
+		{"line separators", "a\u2028b\u2029c", "a\u2028b\u2029c"},
+		{"multibyte", "中文 😀 </script>", "中文 😀 </script>"},
+		{"empty", "", ""},
+	}
+	enc := NewJSONEncoder()
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			//正文走appendJSONEscapedBytes，字段的key和值走appendJSONEscaped
+			ent := &Entry{Level: InfoLevel, Time: time.Now(), Message: []byte(c.value),
+				Fields: []Field{String("k\"\n"+c.value, c.value)}}
+			obj := encodeJSON(t, enc, ent)
+			if obj["msg"] != c.want {
+				t.Errorf("msg = %q, want %q", obj["msg"], c.want)
+			}
+			if obj["k\"\n"+c.want] != c.want {
+				t.Errorf("field = %v, want %q", obj, c.want)
+			}
+		})
+	}
+
+	//U+2028/U+2029 在JavaScript中是换行符，必须转义，不能原样输出
+	msg := NewLogMsg()
+	enc.EncodeEntry(msg, &Entry{Message: []byte("a\u2028b\u2029c")})
+	if strings.ContainsAny(string(msg.GetBytes()), "\u2028\u2029") || !strings.Contains(string(msg.GetBytes()), `a\u2028b\u2029c`) {
+		t.Fatalf("line separators not escaped: %q", msg.GetBytes())
+	}
+}
+
+func TestJSONFieldTypes(t *testing.T) {
+	when := time.Date(2026, 10, 18, 9, 30, 0, 123456000, time.UTC)
+	ent := &Entry{Level: ErrorLevel, Time: when, Message: []byte("typed"), Fields: []Field{
+		Int("int", -42),
+		Int64("int64", math.MaxInt64),
+		Float64("float", 1.5),
+		Float64("nan", math.NaN()),
+		Float64("inf", math.Inf(1)),
+		Float64("ninf", math.Inf(-1)),
+		Bool("yes", true),
+		Bool("no", false),
+		Duration("elapsed", 1500*time.Millisecond),
+		Time("when", when),
+		Time("local", when.In(time.FixedZone("CST", 8*3600))),
+		Err(errors.New("disk \"full\"")),
+		Any("obj", map[string]int{"a": 1}),
+		Any("bad", make(chan int)),
+	}}
+	obj := encodeJSON(t, NewJSONEncoder(), ent)
+
+	want := map[string]interface{}{
+		"level":   "ERROR",
+		"msg":     "typed",
+		"int":     float64(-42),
+		"int64":   float64(math.MaxInt64),
+		"float":   1.5,
+		"nan":     "NaN", //NaN和Inf不是合法的JSON数字，以字符串输出
+		"inf":     "+Inf",
+		"ninf":    "-Inf",
+		"yes":     true,
+		"no":      false,
+		"elapsed": 1.5,
+		"when":    "2026-10-18T09:30:00.123456Z",
+		"local":   "2026-10-18T17:30:00.123456+08:00",
+		"error":   `disk "full"`,
+	}
+	for k, v := range want {
+		if obj[k] != v {
+			t.Errorf("%s = %#v, want %#v", k, obj[k], v)
+		}
+	}
+	if m, ok := obj["obj"].(map[string]interface{}); !ok || m["a"] != float64(1) {
+		t.Errorf("obj = %#v", obj["obj"])
+	}
+	if s, ok := obj["bad"].(string); !ok || !strings.Contains(s, "unsupported type") {
+		t.Errorf("unmarshalable Any = %#v, want the error string", obj["bad"])
+	}
+
+	obj = encodeJSON(t, NewJSONEncoder(), &Entry{Fields: []Field{Err(nil)}})
+	if v, ok := obj["error"]; !ok || v != nil {
+		t.Errorf("nil error = %#v, want null", v)
+	}
+}
+
+func TestJSONContextFields(t *testing.T) {
+	enc := NewJSONEncoder()
+	ctx := NewLogMsg()
+	enc.EncodeFields(ctx, []Field{String("req", "abc"), Int("tenant", 7)})
+
+	//上下文字段前 有其他字段
+	obj := encodeJSON(t, enc, &Entry{Time: time.Now(), Context: ctx.GetBytes(), Message: []byte("m")})
+	if obj["req"] != "abc" || obj["tenant"] != float64(7) || obj["msg"] != "m" {
+		t.Fatalf("context fields = %#v", obj)
+	}
+
+	//上下文字段 紧跟在 { 之后，要去掉开头的逗号
+	bare := &JSONEncoder{MessageKey: "msg"}
+	obj = encodeJSON(t, bare, &Entry{Context: ctx.GetBytes(), Message: []byte("m")})
+	if len(obj) != 3 || obj["req"] != "abc" {
+		t.Fatalf("context fields without header keys = %#v", obj)
+	}
+
+	//所有key都为空，只有上下文字段
+	obj = encodeJSON(t, &JSONEncoder{}, &Entry{Context: ctx.GetBytes()})
+	if len(obj) != 2 {
+		t.Fatalf("context-only entry = %#v", obj)
+	}
+	obj = encodeJSON(t, &JSONEncoder{}, &Entry{})
+	if len(obj) != 0 {
+		t.Fatalf("empty entry = %#v", obj)
+	}
+}
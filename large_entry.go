@@ -0,0 +1,76 @@
+package zlog
+
+import (
+	"strconv"
+	"unicode/utf8"
+)
+
+const (
+	DEFAULT_MAX_ENTRY_SIZE int = 1024 * 1024 //单条日志的默认最大长度
+	MIN_MAX_ENTRY_SIZE     int = 256         //WithMaxEntrySize的下限，要放得下header和截断标记
+)
+
+//截断标记：...[truncated 12345 bytes]，数字是 被截掉的字节数
+const (
+	truncatedPrefix = "...[truncated "
+	truncatedSuffix = " bytes]"
+	truncatedMaxLen = len(truncatedPrefix) + 20 + len(truncatedSuffix)
+)
+
+func appendTruncated(b []byte, dropped int) []byte {
+	b = append(b, truncatedPrefix...)
+	b = strconv.AppendInt(b, int64(dropped), 10)
+	return append(b, truncatedSuffix...)
+}
+
+//按UTF-8字符的边界 截断，不把一个字符截成两半
+func runeBoundary(b []byte, n int) int {
+	for n > 0 && n < len(b) && !utf8.RuneStart(b[n]) {
+		n--
+	}
+	return n
+}
+
+//超过maxEntrySize的日志：先截短正文，重新编码(JSON等格式 仍然合法)；
+//上下文字段或结构化字段太长 截短正文也不够时，直接截断编码后的日志串，JSON不再完整. 截断处 加上截断标记.
+func (l *Logger) truncateEntry(enc Encoder, msg *LogMsg, ent *Entry) {
+	//JSON转义 可能使正文变长，最多重试几次
+	for i := 0; i < 3 && msg.GetLength() > l.maxEntrySize; i++ {
+		keep := len(ent.Message) - (msg.GetLength() - l.maxEntrySize) - truncatedMaxLen
+		if keep <= 0 {
+			break
+		}
+		keep = runeBoundary(ent.Message, keep)
+		//ent.Message 指向正文的LogMsg，截掉的部分 不再需要，标记直接写在原处
+		ent.Message = appendTruncated(ent.Message[:keep], len(ent.Message)-keep)
+		msg.Clear()
+		enc.EncodeEntry(msg, ent)
+	}
+
+	if msg.GetLength() > l.maxEntrySize {
+		cut := runeBoundary(msg.GetBytes(), l.maxEntrySize-truncatedMaxLen-1)
+		dropped := msg.GetLength() - cut - 1 //不计 末尾的换行符
+		msg.setBytes(appendTruncated(msg.logContent[:cut], dropped))
+		msg.growByte('\n')
+	}
+}
+
+//比一个buffer还大的日志：单独分配一个刚好放得下的buffer，排在分片currentBuffer之后 交给 刷日志routine，
+//与同一分片的其他日志 保持打印的顺序，写出后 释放. 单独的buffer 也受内存上限(WithMemoryLimit)的限制
+//调用时 持有分片的锁
+func (l *Logger) appendLarge(s *bufferShard, msg *LogMsg) bool {
+	size := msg.GetLength() + 1
+	buf := newGrowableBuffer(size, size, l.budget)
+	if buf == nil {
+		return false
+	}
+	buf.oneOff = true
+	buf.AppendByte(msg.GetBytes())
+
+	if s.currentBuffer != nil && s.currentBuffer.GetLength() > 0 {
+		l.fullBuffers.PushBuffer(s.currentBuffer)
+		s.currentBuffer = nil //下一条日志 再取emptyBuffer
+	}
+	l.fullBuffers.PushBuffer(buf)
+	return true
+}
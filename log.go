@@ -1,109 +1,196 @@
 package zlog
 
 import (
+	"context"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 //设置 输出到文件
 func SetWriteTypeFile(logFilePath string) error {
 	fw, err := NewFileWriter(defaultLogger, logFilePath)
-	defaultLogger.writer = fw
+	if err != nil {
+		return err
+	}
+	//已缓存的日志 用原来的编码器 写入原来的writer，然后关闭它；之后的日志 用新的编码器 写入文件
+	installed, err := defaultLogger.setWriterAndEncoder(fw, defaultLogger.defaultEncoder(fw))
+	if !installed {
+		fw.Close()
+	}
 	return err
 }
 
 //设置 输出到屏幕
 func SetWriteTypeConsole() error {
 	fw := NewConsoleWriter()
-	defaultLogger.writer = fw
-	return nil
+	_, err := defaultLogger.setWriterAndEncoder(fw, defaultLogger.defaultEncoder(fw))
+	return err
+}
+
+//设置 默认Logger的编码格式，例如 SetEncoder(NewJSONEncoder())，之后的SetWriteTypeFile/SetWriteTypeConsole 保留这个编码器
+func SetEncoder(encoder Encoder) error {
+	return defaultLogger.SetEncoder(encoder)
 }
 
 //设置日志级别
 func SetLogLevel(level LogLevel) {
 	if (defaultLogger != nil) {
-		defaultLogger.currentLevel = level
+		defaultLogger.SetLevel(level)
 	}
 }
 
 //设置 是否 在日志中打印 （文件名，行号，函数名）
 //由于 （文件名，行号，函数名）信息是在运行期获取，会影响性能，建议 在测试开发期间 设置打印，在生产环境中 设置不打印.
 func SetPrintFileNameLineNo(isAble bool) {
-	defaultLogger.isPrintFileNameLineNo = isAble
+	defaultLogger.SetPrintFileNameLineNo(isAble)
 }
 
-//即时刷出日志到文件中(可在exit前，或者 崩溃前调用)
+//即时刷出日志到文件中(可在exit前，或者 崩溃前调用)，最多等待DefaultSyncTimeout
 func FlushAll() {
-	defaultLogger.wakeup()
-	time.Sleep(1 * time.Second)   //等1秒（等待 刷日志routine 将buffer中的日志写入文件）
-	defaultLogger.writer.Flush()
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultSyncTimeout)
+	defer cancel()
+	defaultLogger.Sync(ctx)
 }
 
-//停止 打印
+//停止 打印，刷出已缓存的日志，最多等待DefaultSyncTimeout
 func StopLogging() {
 	if (defaultLogger != nil) {
-		defaultLogger.isRunning = false
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultSyncTimeout)
+		defer cancel()
+		defaultLogger.Close(ctx)
 	}
 }
 
+//等待 默认Logger已缓存的日志 全部写入writer并Flush，见Logger.Sync
+func Sync(ctx context.Context) error {
+	return defaultLogger.Sync(ctx)
+}
+
 func Debugln(args ...interface{}) {
-	if defaultLogger.isRunning == true && defaultLogger.currentLevel <= DebugLevel {
+	if defaultLogger.isEnabled(DebugLevel) {
 		defaultLogger.print(DebugLevel, args...)
 	}
 }
 
 func Debuglnf(format string, args ...interface{}) {
-	if defaultLogger.isRunning == true && defaultLogger.currentLevel <= DebugLevel {
+	if defaultLogger.isEnabled(DebugLevel) {
 		defaultLogger.printf(DebugLevel, format, args...)
 	}
 }
 
 func Infoln(args ...interface{}) {
-	if defaultLogger.isRunning == true && defaultLogger.currentLevel <= InfoLevel {
+	if defaultLogger.isEnabled(InfoLevel) {
 		defaultLogger.print(InfoLevel, args...)
 	}
 }
 
 func Infolnf(format string, args ...interface{}) {
-	if defaultLogger.isRunning == true && defaultLogger.currentLevel <= InfoLevel {
+	if defaultLogger.isEnabled(InfoLevel) {
 		defaultLogger.printf(InfoLevel, format, args...)
 	}
 }
 
 func Warnln(args ...interface{}) {
-	if defaultLogger.isRunning == true && defaultLogger.currentLevel <= WarnLevel {
+	if defaultLogger.isEnabled(WarnLevel) {
 		defaultLogger.print(WarnLevel, args...)
 	}
 }
 
 func Warnlnf(format string, args ...interface{}) {
-	if defaultLogger.isRunning == true && defaultLogger.currentLevel <= WarnLevel {
+	if defaultLogger.isEnabled(WarnLevel) {
 		defaultLogger.printf(WarnLevel, format, args...)
 	}
 }
 
 func Errorln(args ...interface{}) {
-	if defaultLogger.isRunning == true && defaultLogger.currentLevel <= ErrorLevel {
+	if defaultLogger.isEnabled(ErrorLevel) {
 		defaultLogger.print(ErrorLevel, args...)
 	}
 }
 
 func Errorlnf(format string, args ...interface{}) {
-	if defaultLogger.isRunning == true && defaultLogger.currentLevel <= ErrorLevel {
+	if defaultLogger.isEnabled(ErrorLevel) {
 		defaultLogger.printf(ErrorLevel, format, args...)
 	}
 }
 
+//Panic日志 写出并落盘后 panic，panic的值为 日志正文
+func Panicln(args ...interface{}) {
+	if defaultLogger.isEnabled(PanicLevel) {
+		defaultLogger.print(PanicLevel, args...)
+	}
+	defaultLogger.syncBeforeCrash()
+	panic(fmt.Sprint(args...))
+}
+
+func Paniclnf(format string, args ...interface{}) {
+	if defaultLogger.isEnabled(PanicLevel) {
+		defaultLogger.printf(PanicLevel, format, args...)
+	}
+	defaultLogger.syncBeforeCrash()
+	panic(fmt.Sprintf(format, args...))
+}
+
+//Fatal日志 写出并落盘后 退出进程，见WithFatalExitCode
 func Fatalln(args ...interface{}) {
-	if defaultLogger.isRunning == true && defaultLogger.currentLevel <= FatalLevel {
+	if defaultLogger.isEnabled(FatalLevel) {
 		defaultLogger.print(FatalLevel, args...)
 	}
+	defaultLogger.fatalExit()
 }
 
 func Fatallnf(format string, args ...interface{}) {
-	if defaultLogger.isRunning == true && defaultLogger.currentLevel <= FatalLevel {
+	if defaultLogger.isEnabled(FatalLevel) {
 		defaultLogger.printf(FatalLevel, format, args...)
 	}
+	defaultLogger.fatalExit()
+}
+
+//结构化日志：正文后 以 key=value 的形式追加字段，例如 zlog.Infow("login", zlog.String("user", name), zlog.Int("uid", uid))
+func Debugw(message string, fields ...Field) {
+	if defaultLogger.isEnabled(DebugLevel) {
+		defaultLogger.printw(DebugLevel, message, fields)
+	}
+}
+
+func Infow(message string, fields ...Field) {
+	if defaultLogger.isEnabled(InfoLevel) {
+		defaultLogger.printw(InfoLevel, message, fields)
+	}
+}
+
+func Warnw(message string, fields ...Field) {
+	if defaultLogger.isEnabled(WarnLevel) {
+		defaultLogger.printw(WarnLevel, message, fields)
+	}
+}
+
+func Errorw(message string, fields ...Field) {
+	if defaultLogger.isEnabled(ErrorLevel) {
+		defaultLogger.printw(ErrorLevel, message, fields)
+	}
+}
+
+func Panicw(message string, fields ...Field) {
+	if defaultLogger.isEnabled(PanicLevel) {
+		defaultLogger.printw(PanicLevel, message, fields)
+	}
+	defaultLogger.syncBeforeCrash()
+	panic(message)
+}
+
+func Fatalw(message string, fields ...Field) {
+	if defaultLogger.isEnabled(FatalLevel) {
+		defaultLogger.printw(FatalLevel, message, fields)
+	}
+	defaultLogger.fatalExit()
+}
+
+//基于默认Logger 创建带上下文字段的子Logger
+func With(fields ...Field) *Logger {
+	return defaultLogger.With(fields...)
 }
 
 // default
@@ -112,23 +199,59 @@ var (
 	recordPool  *sync.Pool
 )
 
-type Writer interface {
-	formatHeader(level LogLevel, isPrintFileName bool) *LogMsg
-	Write(content []byte) error
-	Flush()
+//Logger = 共享的loggerCore + 自己的上下文字段
+//With() 创建的子Logger 与父Logger 共用同一个loggerCore(buffers, writer, 日志级别, 刷日志routine)
+type Logger struct {
+	*loggerCore
+	fields			[]Field             //With()的上下文字段(包括父Logger的)，追加在每条日志的header之后
+	context			atomic.Pointer[encodedContext]  //fields按编码器 预先编码好的结果，用contextFor()读取
 }
 
-type Logger struct {
-	writer     		Writer
-	currentLevel 	  	LogLevel            //当前日志级别
-	currentBuffer  		*LogMsgBuffer
-	curBufMutex     	sync.Mutex
+//上下文字段 按某个编码器编码的结果
+type encodedContext struct {
+	encoder *encoderHolder
+	bytes   []byte
+}
+
+type loggerCore struct {
+	writer     		atomic.Pointer[sinkHolder]     //运行期可替换，用getWriter()读取
+	encoder			atomic.Pointer[encoderHolder]  //运行期可替换，用getEncoder()读取
+	encoderChosen	atomic.Bool  //用户选择了编码器(WithEncoder, SetEncoder)，更换writer时 不再换成默认的编码器
+	currentLevel 	  	atomic.Uint32       //当前日志级别
+	shards			[]bufferShard       //每个分片 有自己的currentBuffer
+	shardNum		int                 //分片的个数
+	seq			atomic.Uint64       //分片多于一个时，每条日志的序号
 	flushInterval   	int                 //刷出日志的间隔 (单位：秒)
 	emptyBuffers    	*BufferContainer
 	fullBuffers     	*BufferContainer
-	isRunning		bool   		    /* atomic */
-	isWaitingAvailBuffer  	bool		    /* atomic */
-	isPrintFileNameLineNo  	bool
+	isRunning		atomic.Bool
+	isWaitingAvailBuffer  	atomic.Bool
+	isPrintFileNameLineNo  	atomic.Bool
+	bufferNum		int                 //buffer的个数
+	bufferSize		int                 //每个buffer的容量
+	fallback		Sink                //writer写入失败时的备用输出
+	errorHandler		func(err error)     //writer出错时的回调
+	errCount		atomic.Uint64       //writer出错的次数
+	lastErr			atomic.Value        //最近一次的错误，类型为errorValue
+	syncRequests		chan syncRequest    //Sync()和Close()的请求，由 刷日志routine 处理
+	closed			atomic.Bool         //Close()之后 不再接受新日志，修改时 锁住所有分片 和 syncMutex
+	syncMutex		sync.RWMutex        //发送Sync()等请求时 加读锁，Close()设置closed时 加写锁
+	writingBytes		atomic.Int64        //刷日志routine 正在写出的字节数
+	overflowPolicy		OverflowPolicy      //没有可用buffer时 如何处理新的日志
+	overflowTimeout		time.Duration       //OverflowBlock策略 最多等待的时间
+	spillLimit		int                 //OverflowSpill策略 临时buffer的总大小上限
+	spillBytes		atomic.Int64        //当前临时buffer的总大小
+	keepLevel		LogLevel            //OverflowDropByLevel策略 不丢弃的最低级别
+	dropped			dropCounters        //按级别 丢弃的日志条数和字节数
+	reported		Stats               //上一次 丢失日志提示 时的统计，只在 写提示的routine 中访问
+	memoryLimit		int                 //所有buffer占用内存的上限，0表示不限制
+	budget			*memoryBudget
+	idleRelease		time.Duration       //没有日志多久之后 释放空闲的buffer
+	maxEntrySize		int                 //单条日志的最大长度，超过时截断，0表示不限制
+	flushLevel		LogLevel            //打印该级别及以上的日志后 立即写出
+	flushWait		time.Duration       //立即写出时 最多等待的时间
+	fatalExitCode		int                 //Fatal日志写出后 退出进程的返回码
+	stackLevel		LogLevel            //打印该级别及以上的日志时 记录调用栈
 }
 
 func init() {
@@ -140,54 +263,319 @@ func init() {
 	}
 }
 
-func NewLogger() *Logger {
-	if defaultLogger != nil {
-		return defaultLogger
+//创建一个独立的Logger，每个Logger拥有自己的buffers和 刷日志routine
+func NewLogger(opts ...Option) *Logger {
+	logger := &Logger{loggerCore: new(loggerCore)}
+	logger.SetLevel(DebugLevel)
+	logger.flushInterval = 3
+	logger.bufferNum = DEFAULT_BUFFER_NUM
+	logger.bufferSize = DEFALUT_BUFFER_SIZE
+	logger.shardNum = 1
+	logger.isPrintFileNameLineNo.Store(true)
+	logger.fallback = NewStderrWriter()
+	logger.idleRelease = DEFAULT_IDLE_RELEASE
+	logger.maxEntrySize = DEFAULT_MAX_ENTRY_SIZE
+	logger.flushLevel = noLevel
+	logger.stackLevel = noLevel
+	logger.fatalExitCode = DEFAULT_FATAL_EXIT_CODE
+	for _, opt := range opts {
+		opt(logger)
+	}
+	if logger.getWriter() == nil {
+		logger.setWriter(NewConsoleWriter())
+	}
+	if logger.getEncoder() == nil {
+		logger.setEncoder(logger.defaultEncoder(logger.getWriter()))
 	}
 
-	logger := new(Logger)
-	logger.currentLevel = DebugLevel
-	logger.writer = NewConsoleWriter()
-	logger.flushInterval = 3
-	logger.emptyBuffers = NewBufferContainer(DEFAULT_BUFFER_NUM, DEFAULT_BUFFER_NUM, DEFALUT_BUFFER_SIZE)
-	logger.fullBuffers = NewBufferContainer(0, DEFAULT_BUFFER_NUM, DEFALUT_BUFFER_SIZE)
-	logger.currentBuffer = logger.emptyBuffers.PopBuffer()
-	logger.isRunning = true
-	logger.isWaitingAvailBuffer = false
-	logger.isPrintFileNameLineNo = true
+	//每个分片 至少要有两个buffer轮换
+	if logger.bufferNum < 2*logger.shardNum {
+		logger.bufferNum = 2 * logger.shardNum
+	}
+	//buffer按需分配：开始时 只有一个较小的buffer
+	initSize := DEFAULT_INIT_BUFFER_SIZE
+	if initSize > logger.bufferSize {
+		initSize = logger.bufferSize
+	}
+	logger.budget = newMemoryBudget(logger.memoryLimit)
+	logger.emptyBuffers = NewLazyBufferContainer(1, logger.bufferNum, initSize, logger.bufferSize, logger.budget)
+	logger.fullBuffers = NewBufferContainer(0, logger.bufferNum, logger.bufferSize)
+	logger.shards = make([]bufferShard, logger.shardNum)
+	logger.isRunning.Store(true)
+	logger.isWaitingAvailBuffer.Store(false)
+	logger.syncRequests = make(chan syncRequest, 16)
 	go flushFullBuffers(logger)
 
 	return logger
 }
 
-func flushFullBuffers(logger *Logger) {
-	for ;logger.isRunning; {
+//用户没有选择编码器时，按writer返回默认的编码器：输出到屏幕时 用不同的颜色区分日志级别，否则为文本格式
+//用户选择过编码器时 返回nil，表示不更换
+func (l *Logger) defaultEncoder(writer Sink) Encoder {
+	if l.encoderChosen.Load() {
+		return nil
+	}
+	if _, ok := writer.(*ConsoleWriter); ok {
+		return NewColorTextEncoder()
+	}
+	return NewTextEncoder()
+}
 
-		logger.fullBuffers.WaitNewBuffer(logger.flushInterval)
+//返回 包级函数(Debugln, Infoln...)所使用的默认Logger
+func Default() *Logger {
+	return defaultLogger
+}
 
-		logger.curBufMutex.Lock()
-		if (logger.currentBuffer != nil && logger.currentBuffer.GetLength() > 0) {
-			logger.fullBuffers.PushBuffer(logger.currentBuffer)
-			logger.currentBuffer = logger.emptyBuffers.PopBuffer()
-		}
-		logger.curBufMutex.Unlock()
+//返回一个子Logger，它与父Logger共用buffers和writer，之后 子Logger打印的每条日志 都在header之后带上这些字段
+//fields按当前的编码器 只编码一次并缓存，更换编码器(SetEncoder等)后 第一次打印时 按新的编码器重新编码
+func (l *Logger) With(fields ...Field) *Logger {
+	if len(fields) == 0 {
+		return l
+	}
+
+	child := &Logger{loggerCore: l.loggerCore}
+	child.fields = make([]Field, 0, len(l.fields)+len(fields))
+	child.fields = append(child.fields, l.fields...)
+	child.fields = append(child.fields, fields...)
+	child.contextFor(l.encoder.Load())
+	return child
+}
+
+//上下文字段 按enc编码的结果
+func (l *Logger) contextFor(enc *encoderHolder) []byte {
+	if len(l.fields) == 0 {
+		return nil
+	}
+	if c := l.context.Load(); c != nil && c.encoder == enc {
+		return c.bytes
+	}
+
+	msg := recordPool.Get().(*LogMsg)
+	enc.EncodeFields(msg, l.fields)
+	c := &encodedContext{encoder: enc, bytes: append([]byte(nil), msg.GetBytes()...)}
+	msg.Clear()
+	recordPool.Put(msg)
+	l.context.Store(c)
+	return c.bytes
+}
+
+//判断 该级别的日志是否需要打印
+func (l *Logger) isEnabled(level LogLevel) bool {
+	return l.isRunning.Load() && LogLevel(l.currentLevel.Load()) <= level
+}
+
+//Logger的分级打印接口，与包级函数(Debugln, Debuglnf...)一一对应
+//注意：包级函数 与 这些方法 都直接调用print/printf，以保证 runtime.Caller 的调用深度一致
+func (l *Logger) Debug(args ...interface{}) {
+	if l.isEnabled(DebugLevel) {
+		l.print(DebugLevel, args...)
+	}
+}
+
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	if l.isEnabled(DebugLevel) {
+		l.printf(DebugLevel, format, args...)
+	}
+}
 
-		if (logger.fullBuffers.IsEmpty()) {
-			continue
+func (l *Logger) Info(args ...interface{}) {
+	if l.isEnabled(InfoLevel) {
+		l.print(InfoLevel, args...)
+	}
+}
+
+func (l *Logger) Infof(format string, args ...interface{}) {
+	if l.isEnabled(InfoLevel) {
+		l.printf(InfoLevel, format, args...)
+	}
+}
+
+func (l *Logger) Warn(args ...interface{}) {
+	if l.isEnabled(WarnLevel) {
+		l.print(WarnLevel, args...)
+	}
+}
+
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	if l.isEnabled(WarnLevel) {
+		l.printf(WarnLevel, format, args...)
+	}
+}
+
+func (l *Logger) Error(args ...interface{}) {
+	if l.isEnabled(ErrorLevel) {
+		l.print(ErrorLevel, args...)
+	}
+}
+
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	if l.isEnabled(ErrorLevel) {
+		l.printf(ErrorLevel, format, args...)
+	}
+}
+
+//Panic日志 写出并落盘后 panic，panic的值为 日志正文
+func (l *Logger) Panic(args ...interface{}) {
+	if l.isEnabled(PanicLevel) {
+		l.print(PanicLevel, args...)
+	}
+	l.syncBeforeCrash()
+	panic(fmt.Sprint(args...))
+}
+
+func (l *Logger) Panicf(format string, args ...interface{}) {
+	if l.isEnabled(PanicLevel) {
+		l.printf(PanicLevel, format, args...)
+	}
+	l.syncBeforeCrash()
+	panic(fmt.Sprintf(format, args...))
+}
+
+//Fatal日志 写出并落盘后 退出进程，见WithFatalExitCode
+func (l *Logger) Fatal(args ...interface{}) {
+	if l.isEnabled(FatalLevel) {
+		l.print(FatalLevel, args...)
+	}
+	l.fatalExit()
+}
+
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	if l.isEnabled(FatalLevel) {
+		l.printf(FatalLevel, format, args...)
+	}
+	l.fatalExit()
+}
+
+func (l *Logger) Debugw(message string, fields ...Field) {
+	if l.isEnabled(DebugLevel) {
+		l.printw(DebugLevel, message, fields)
+	}
+}
+
+func (l *Logger) Infow(message string, fields ...Field) {
+	if l.isEnabled(InfoLevel) {
+		l.printw(InfoLevel, message, fields)
+	}
+}
+
+func (l *Logger) Warnw(message string, fields ...Field) {
+	if l.isEnabled(WarnLevel) {
+		l.printw(WarnLevel, message, fields)
+	}
+}
+
+func (l *Logger) Errorw(message string, fields ...Field) {
+	if l.isEnabled(ErrorLevel) {
+		l.printw(ErrorLevel, message, fields)
+	}
+}
+
+func (l *Logger) Panicw(message string, fields ...Field) {
+	if l.isEnabled(PanicLevel) {
+		l.printw(PanicLevel, message, fields)
+	}
+	l.syncBeforeCrash()
+	panic(message)
+}
+
+func (l *Logger) Fatalw(message string, fields ...Field) {
+	if l.isEnabled(FatalLevel) {
+		l.printw(FatalLevel, message, fields)
+	}
+	l.fatalExit()
+}
+
+func flushFullBuffers(logger *Logger) {
+	var requests []syncRequest
+	lastActive := time.Now()
+	released := false
+	for {
+		logger.fullBuffers.WaitNewBuffer(logger.flushInterval)
+
+		//本轮开始前 已提交的Sync请求，在本轮写完、Flush之后 回复
+		requests = logger.takeSyncRequests(requests[:0])
+
+		//合并各分片的currentBuffer，取出fullBuffers
+		var tmpBuffers []*LogMsgBuffer
+		if encoder := requestedEncoder(requests); encoder != nil {
+			//更换编码器 与 取出buffer 在同一次加锁中：之前的日志 写入旧writer，之后的日志 用新编码器
+			logger.withAllShardsLocked(func() {
+				for i := range logger.shards {
+					logger.pushShardLocked(&logger.shards[i])
+				}
+				logger.setEncoder(encoder)
+				tmpBuffers = logger.fullBuffers.GetAllBuffersAndClear()
+			})
+		} else {
+			logger.pushShards()
+			tmpBuffers = logger.fullBuffers.GetAllBuffersAndClear()
 		}
 
 		//将fullBuffers中的内容 写入文件中
-		tmpBuffers := logger.fullBuffers.GetAllBuffersAndClear()
+		var err error
+		for _, buf := range tmpBuffers {
+			logger.writingBytes.Add(int64(buf.GetLength()))
+		}
 		for _, buf := range tmpBuffers {
-			logger.writer.Write(buf.GetBytes())
+			if werr := logger.writeToSink(buf.GetBytes()); werr != nil && err == nil {
+				err = werr
+			}
+			logger.writingBytes.Add(-int64(buf.GetLength()))
 			buf.Clear()
 		}
+		//临时分配的buffer 不放回emptyBuffers，交给GC回收
+		reusable := tmpBuffers[:0]
+		for _, buf := range tmpBuffers {
+			if buf.spilled {
+				logger.spillBytes.Add(-int64(buf.capacity))
+				buf.free()
+			} else if buf.oneOff {
+				buf.free()
+			} else {
+				reusable = append(reusable, buf)
+			}
+		}
+		if len(reusable) > 0 {
+			logger.emptyBuffers.PushBuffers(reusable)
+		}
 
-		logger.emptyBuffers.PushBuffers(tmpBuffers)
-		logger.writer.Flush()
-	}
+		if len(tmpBuffers) > 0 {
+			lastActive = time.Now()
+			released = false
+		} else if !released && logger.idleRelease > 0 && time.Since(lastActive) >= logger.idleRelease {
+			//一段时间没有日志，释放空闲的buffer
+			logger.releaseIdleBuffers()
+			released = true
+		}
 
-	//flush余下的内容
-	logger.writer.Flush()
-}
+		//没有新日志时 也要Flush，FileWriter在Flush中检查 是否到了切换文件的时刻
+		if ferr := logger.flushSink(); ferr != nil && err == nil {
+			err = ferr
+		}
 
+		closing := false
+		for _, req := range requests {
+			reqErr := err
+			if req.fsync {
+				if serr := logger.syncSink(); serr != nil && reqErr == nil {
+					reqErr = serr
+				}
+			}
+			if req.writer != nil {
+				if werr := logger.switchWriter(req.writer); werr != nil && reqErr == nil {
+					reqErr = werr
+				}
+			}
+			if req.close {
+				closing = true
+				if cerr := closeSink(logger.getWriter()); cerr != nil && reqErr == nil {
+					reqErr = cerr
+				}
+			}
+			req.done <- reqErr
+		}
+		if closing {
+			return
+		}
+	}
+}
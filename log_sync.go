@@ -0,0 +1,227 @@
+package zlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+//FlushAll()和StopLogging() 最多等待的时间
+const DefaultSyncTimeout = 3 * time.Second
+
+var ErrLoggerClosed = errors.New("zlog: logger is closed")
+
+//Fatal日志之后 默认的进程返回码
+const DEFAULT_FATAL_EXIT_CODE = 1
+
+//Fatal日志写出后 调用，测试时可替换
+var osExit = os.Exit
+
+//Sync()、Close()和SetWriter()提交给 刷日志routine 的请求
+type syncRequest struct {
+	done    chan error //本轮写完后 回复写入或Flush的错误
+	close   bool       //回复之后 刷日志routine 退出
+	writer  Sink       //非nil时，本轮写完后 关闭旧writer，换成这个writer
+	encoder Encoder    //非nil时，与writer一起更换，本轮取出buffer时 换上
+	fsync   bool       //Flush之后 调用writer的Sync()，把内容落盘
+}
+
+//等待 调用Sync之前打印的日志 全部写入writer并Flush.
+//ctx到期时 返回错误，说明 还有多少字节没有写出；writer出错时 返回该错误.
+func (l *Logger) Sync(ctx context.Context) error {
+	if l.closed.Load() {
+		return ErrLoggerClosed
+	}
+	return l.requestSync(ctx, syncRequest{})
+}
+
+//停止打印，等待已缓存的日志 全部写入writer并Flush，关闭writer(若实现了io.Closer)，然后 刷日志routine 退出.
+//Close之后 打印的日志 被丢弃，再次调用Close 返回ErrLoggerClosed.
+func (l *Logger) Close(ctx context.Context) error {
+	//锁住所有分片，保证 Close之后 不会再有日志写入buffer
+	//锁住syncMutex，保证 Close之后 不会再有请求发给 刷日志routine
+	alreadyClosed := false
+	l.syncMutex.Lock()
+	l.withAllShardsLocked(func() {
+		alreadyClosed = l.closed.Swap(true)
+		l.isRunning.Store(false)
+	})
+	l.syncMutex.Unlock()
+	if alreadyClosed {
+		return ErrLoggerClosed
+	}
+	return l.requestSync(ctx, syncRequest{close: true})
+}
+
+//更换输出目的地：已缓存的日志 先全部写入旧writer并Flush，再关闭旧writer(若实现了io.Closer)，然后换成新的writer.
+//每条日志 要么完整地写入旧writer，要么完整地写入新writer.
+//最多等待DefaultSyncTimeout，超时后 更换仍会在 刷日志routine 写完之后进行.
+func (l *Logger) SetWriter(writer Sink) error {
+	_, err := l.setWriterAndEncoder(writer, nil)
+	return err
+}
+
+//更换编码器：已写入buffer的日志 已经编码好，仍写入原样；之后的日志 用新的编码器
+//可在运行期 与打印日志 并发调用，更换writer(SetWriter)时 保留这个编码器
+func (l *Logger) SetEncoder(encoder Encoder) error {
+	if encoder == nil {
+		return errors.New("zlog: nil encoder")
+	}
+	l.encoderChosen.Store(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultSyncTimeout)
+	defer cancel()
+	return l.requestSync(ctx, syncRequest{encoder: encoder})
+}
+
+//同SetWriter，同时更换编码器(encoder为nil时 不更换)：换上新writer之后写入buffer的日志 都用新编码器
+//返回的installed为false时，请求没有交给 刷日志routine，writer不会被使用
+func (l *Logger) setWriterAndEncoder(writer Sink, encoder Encoder) (installed bool, err error) {
+	if writer == nil {
+		return false, errors.New("zlog: nil writer")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultSyncTimeout)
+	defer cancel()
+	done, err := l.sendSyncRequest(ctx, syncRequest{writer: writer, encoder: encoder})
+	if err != nil {
+		return false, err
+	}
+	return true, l.waitSyncReply(ctx, done)
+}
+
+//本轮请求中 最后一个要更换的编码器，没有时 返回nil
+func requestedEncoder(requests []syncRequest) Encoder {
+	var encoder Encoder
+	for _, req := range requests {
+		if req.encoder != nil {
+			encoder = req.encoder
+		}
+	}
+	return encoder
+}
+
+//由 刷日志routine 调用
+func (l *Logger) switchWriter(writer Sink) error {
+	old := l.getWriter()
+	l.setWriter(writer)
+	if old == writer {
+		return nil
+	}
+	return closeSink(old)
+}
+
+func closeSink(writer Sink) error {
+	if closer, ok := writer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (l *Logger) requestSync(ctx context.Context, req syncRequest) error {
+	done, err := l.sendSyncRequest(ctx, req)
+	if err != nil {
+		return err
+	}
+	return l.waitSyncReply(ctx, done)
+}
+
+func (l *Logger) waitSyncReply(ctx context.Context, done chan error) error {
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return l.pendingError(ctx.Err())
+	}
+}
+
+//返回nil错误时 请求已交给 刷日志routine，一定会被处理
+func (l *Logger) sendSyncRequest(ctx context.Context, req syncRequest) (chan error, error) {
+	req.done = make(chan error, 1)
+	//检查closed 与 发送请求 在同一个读锁中：请求要么排在Close的请求之前，被 刷日志routine 处理后 才退出，
+	//要么看到closed，不再发送(否则没有routine回复，调用者一直等待)
+	l.syncMutex.RLock()
+	if l.closed.Load() && !req.close {
+		l.syncMutex.RUnlock()
+		return nil, ErrLoggerClosed
+	}
+	select {
+	case l.syncRequests <- req:
+	case <-ctx.Done():
+		l.syncMutex.RUnlock()
+		return nil, l.pendingError(ctx.Err())
+	}
+	l.syncMutex.RUnlock()
+	l.fullBuffers.Notify()
+	return req.done, nil
+}
+
+//取出 已提交的全部请求，不阻塞
+func (l *Logger) takeSyncRequests(requests []syncRequest) []syncRequest {
+	for {
+		select {
+		case req := <-l.syncRequests:
+			requests = append(requests, req)
+		default:
+			return requests
+		}
+	}
+}
+
+//描述 尚未写出的日志：各分片的currentBuffer、fullBuffers，以及 刷日志routine 正在写的
+func (l *Logger) pendingError(cause error) error {
+	bytes := l.fullBuffers.PendingBytes() + l.shardPendingBytes()
+	bytes += int(l.writingBytes.Load())
+
+	return fmt.Errorf("zlog: %d bytes not yet written: %w", bytes, cause)
+}
+
+//实现了Sync()的writer(如FileWriter)，Fatal日志之后 把内容落盘
+type syncer interface {
+	Sync() error
+}
+
+//由 刷日志routine 调用
+func (l *Logger) syncSink() error {
+	s, ok := l.getWriter().(syncer)
+	if !ok {
+		return nil
+	}
+	err := s.Sync()
+	if err != nil {
+		l.writeToFallback(l.getWriter(), nil, err)
+		l.handleError(err)
+	}
+	return err
+}
+
+//把各分片的currentBuffer 交给 刷日志routine，最多等待flushWait，<=0表示不等待
+func (l *Logger) flushEntry() {
+	if l.flushWait <= 0 {
+		l.wakeup()
+		l.fullBuffers.Notify()
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), l.flushWait)
+	defer cancel()
+	l.Sync(ctx)
+}
+
+//进程可能马上退出(Panic, Fatal)：写出已缓存的日志，Flush并落盘，最多等待DefaultSyncTimeout
+func (l *Logger) syncBeforeCrash() {
+	if l.closed.Load() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultSyncTimeout)
+	defer cancel()
+	l.requestSync(ctx, syncRequest{fsync: true})
+}
+
+//Fatal日志之后 退出进程
+func (l *Logger) fatalExit() {
+	l.syncBeforeCrash()
+	osExit(l.fatalExitCode)
+}
@@ -0,0 +1,715 @@
+package zlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//记录写入内容的Sink，可设置为 写入失败
+type memorySink struct {
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	fail error
+}
+
+func (s *memorySink) Write(content []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail != nil {
+		return s.fail
+	}
+	s.buf.Write(content)
+	return nil
+}
+
+func (s *memorySink) Flush() error {
+	return nil
+}
+
+func (s *memorySink) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.String()
+}
+
+func TestWriteErrorGoesToFallback(t *testing.T) {
+	diskFull := errors.New("no space left on device")
+	primary := &memorySink{fail: diskFull}
+	fallback := &memorySink{}
+	handled := make(chan error, 16)
+
+	logger := NewLogger(
+		WithWriter(primary),
+		WithFallback(fallback),
+		WithErrorHandler(func(err error) { handled <- err }),
+		WithFlushInterval(1),
+	)
+	logger.Infow("hello")
+
+	select {
+	case err := <-handled:
+		if err != diskFull {
+			t.Fatalf("handler got %v, want %v", err, diskFull)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("error handler was not called")
+	}
+	if logger.ErrorCount() == 0 || logger.LastError() != diskFull {
+		t.Fatalf("ErrorCount = %d, LastError = %v", logger.ErrorCount(), logger.LastError())
+	}
+	if !bytes.Contains([]byte(fallback.String()), []byte("hello")) {
+		t.Fatalf("fallback content = %q", fallback.String())
+	}
+}
+
+func TestSyncDrainsBuffers(t *testing.T) {
+	sink := &memorySink{}
+	logger := NewLogger(WithWriter(sink), WithFlushInterval(60))
+	for i := 0; i < 100; i++ {
+		logger.Infow("line", Int("i", i))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := logger.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Sync took %v", d)
+	}
+	if n := strings.Count(sink.String(), "\n"); n != 100 {
+		t.Fatalf("lines after Sync = %d, want 100", n)
+	}
+
+	if err := logger.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	logger.Infow("after close")
+	if err := logger.Close(ctx); err != ErrLoggerClosed {
+		t.Fatalf("second Close = %v, want ErrLoggerClosed", err)
+	}
+	if strings.Contains(sink.String(), "after close") {
+		t.Fatal("entry logged after Close was written")
+	}
+}
+
+func TestSyncRacingCloseNeverHangs(t *testing.T) {
+	for i := 0; i < 200; i++ {
+		logger := NewLogger(WithWriter(&memorySink{}), WithFlushInterval(60))
+		done := make(chan error, 4)
+		for j := 0; j < 4; j++ {
+			go func() { done <- logger.Sync(context.Background()) }()
+		}
+		logger.Close(context.Background())
+		for j := 0; j < 4; j++ {
+			select {
+			case err := <-done:
+				if err != nil && err != ErrLoggerClosed {
+					t.Fatalf("Sync = %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Sync racing Close never returned")
+			}
+		}
+	}
+}
+
+//Write一直阻塞的Sink
+type blockingSink struct {
+	release chan struct{}
+}
+
+func (s *blockingSink) Write(content []byte) error {
+	<-s.release
+	return nil
+}
+
+func (s *blockingSink) Flush() error {
+	return nil
+}
+
+func TestSyncTimeoutReportsPending(t *testing.T) {
+	sink := &blockingSink{release: make(chan struct{})}
+	defer close(sink.release)
+	logger := NewLogger(WithWriter(sink), WithFlushInterval(60))
+	logger.Infow("stuck")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := logger.Sync(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Sync = %v, want DeadlineExceeded", err)
+	}
+	if !strings.Contains(err.Error(), "bytes not yet written") || strings.HasPrefix(err.Error(), "zlog: 0 bytes") {
+		t.Fatalf("error does not describe pending data: %v", err)
+	}
+}
+
+//打开gate之前 Write一直阻塞的Sink，模拟写得很慢的磁盘
+type gatedSink struct {
+	memorySink
+	gate chan struct{}
+}
+
+func newGatedSink() *gatedSink {
+	return &gatedSink{gate: make(chan struct{})}
+}
+
+func (s *gatedSink) Write(content []byte) error {
+	<-s.gate
+	return s.memorySink.Write(content)
+}
+
+func syncLogger(t *testing.T, logger *Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := logger.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOverflowBlockKeepsAllEntries(t *testing.T) {
+	sink := newGatedSink()
+	logger := NewLogger(WithWriter(sink), WithBufferNum(2), WithBufferSize(1024), WithOverflowBlock(0))
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(sink.gate)
+	}()
+	for i := 0; i < 200; i++ {
+		logger.Infow("audit", Int("i", i))
+	}
+	syncLogger(t, logger)
+	if n := strings.Count(sink.String(), "audit"); n != 200 {
+		t.Fatalf("entries written = %d, want 200", n)
+	}
+	if strings.Contains(sink.String(), "Lost log msg") {
+		t.Fatal("OverflowBlock should not drop entries")
+	}
+}
+
+func TestOverflowSpill(t *testing.T) {
+	sink := newGatedSink()
+	logger := NewLogger(WithWriter(sink), WithBufferNum(2), WithBufferSize(1024), WithOverflowSpill(64*1024))
+	for i := 0; i < 200; i++ {
+		logger.Infow("spill", Int("i", i))
+	}
+	if logger.spillBytes.Load() == 0 {
+		t.Fatal("no overflow buffer was allocated")
+	}
+	close(sink.gate)
+	syncLogger(t, logger)
+	if n := strings.Count(sink.String(), "spill"); n != 200 {
+		t.Fatalf("entries written = %d, want 200", n)
+	}
+	if n := logger.spillBytes.Load(); n != 0 {
+		t.Fatalf("spillBytes after Sync = %d, want 0", n)
+	}
+}
+
+func TestOverflowDropByLevel(t *testing.T) {
+	sink := newGatedSink()
+	logger := NewLogger(WithWriter(sink), WithBufferNum(4), WithBufferSize(1024), WithOverflowDropByLevel(WarnLevel))
+	for i := 0; i < 200; i++ {
+		logger.Debugw("noise", Int("i", i))
+	}
+	logger.Errorw("important")
+	close(sink.gate)
+	syncLogger(t, logger)
+
+	out := sink.String()
+	if !strings.Contains(out, "important") {
+		t.Fatal("entry at keepLevel was dropped")
+	}
+	if n := strings.Count(out, "noise"); n == 200 {
+		t.Fatal("no debug entry was shed")
+	}
+	//丢失日志的提示 在buffer腾出之后 才由后台routine写入
+	for i := 0; i < 50 && !strings.Contains(out, "Lost log msg"); i++ {
+		time.Sleep(10 * time.Millisecond)
+		syncLogger(t, logger)
+		out = sink.String()
+	}
+	if !strings.Contains(out, "Lost log msg") {
+		t.Fatal("missing loss marker")
+	}
+
+	stats := logger.Stats()
+	shed := uint64(200 - strings.Count(out, "noise"))
+	if stats.DroppedEntries[DebugLevel] != shed || stats.TotalDroppedEntries() != shed {
+		t.Fatalf("dropped entries = %v, want %d debug", stats.DroppedEntries, shed)
+	}
+	if stats.DroppedBytes[DebugLevel] == 0 || stats.DroppedBytes[ErrorLevel] != 0 {
+		t.Fatalf("dropped bytes = %v", stats.DroppedBytes)
+	}
+	if want := ", Dropped:" + strconv.FormatUint(shed, 10) + ", Bytes:"; !strings.Contains(out, want) || !strings.Contains(out, "DEBUG:") {
+		t.Fatalf("loss marker does not report counts: %q", out[strings.Index(out, "Lost log msg"):])
+	}
+}
+
+//记录是否被关闭的Sink
+type closableSink struct {
+	memorySink
+	closed bool
+}
+
+func (s *closableSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func TestSetWriterSwapsEncoderWithWriter(t *testing.T) {
+	oldSink := &memorySink{}
+	newSink := &memorySink{}
+	logger := NewLogger(WithWriter(oldSink), WithEncoder(NewTextEncoder()), WithShards(4), WithPrintFileNameLineNo(false))
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					logger.Infow("entry")
+				}
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	if _, err := logger.setWriterAndEncoder(newSink, NewJSONEncoder()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+	syncLogger(t, logger)
+
+	//旧writer只收到文本格式，新writer只收到JSON格式
+	for _, line := range strings.Split(strings.TrimSpace(oldSink.String()), "\n") {
+		if strings.HasPrefix(line, "{") {
+			t.Fatalf("old writer got a JSON entry: %q", line)
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSpace(newSink.String()), "\n") {
+		if !json.Valid([]byte(line)) {
+			t.Fatalf("new writer got a non-JSON entry: %q", line)
+		}
+	}
+}
+
+func TestSetWriterDrainsOldWriter(t *testing.T) {
+	oldSink := &closableSink{}
+	newSink := &memorySink{}
+	logger := NewLogger(WithWriter(oldSink), WithFlushInterval(60))
+	for i := 0; i < 100; i++ {
+		logger.Infow("before")
+	}
+	if err := logger.SetWriter(newSink); err != nil {
+		t.Fatal(err)
+	}
+	logger.Infow("after")
+	syncLogger(t, logger)
+
+	if n := strings.Count(oldSink.String(), "before"); n != 100 || strings.Contains(oldSink.String(), "after") {
+		t.Fatalf("old writer got %d entries before the switch: %q", n, oldSink.String())
+	}
+	if strings.Contains(newSink.String(), "before") || !strings.Contains(newSink.String(), "after") {
+		t.Fatalf("new writer content = %q", newSink.String())
+	}
+	oldSink.mu.Lock()
+	defer oldSink.mu.Unlock()
+	if !oldSink.closed {
+		t.Fatal("old writer was not closed")
+	}
+}
+
+func TestLargeEntryKeepsOrder(t *testing.T) {
+	sink := &memorySink{}
+	logger := NewLogger(WithWriter(sink), WithBufferSize(1024), WithPrintFileNameLineNo(false))
+	big := strings.Repeat("x", 10000)
+	logger.Infow("first")
+	logger.Infow(big)
+	logger.Infow("last")
+	syncLogger(t, logger)
+
+	lines := strings.Split(strings.TrimSuffix(sink.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3", len(lines))
+	}
+	if !strings.HasSuffix(lines[0], "first") || !strings.HasSuffix(lines[1], big) || !strings.HasSuffix(lines[2], "last") {
+		t.Fatalf("entries out of order or truncated: %q", sink.String()[:80])
+	}
+	if s := logger.Stats(); s.TotalDroppedEntries() != 0 {
+		t.Fatalf("dropped %d entries", s.TotalDroppedEntries())
+	}
+}
+
+func TestMaxEntrySizeTruncates(t *testing.T) {
+	for _, enc := range []Encoder{NewTextEncoder(), NewJSONEncoder()} {
+		sink := &memorySink{}
+		logger := NewLogger(WithWriter(sink), WithEncoder(enc), WithMaxEntrySize(1000))
+		logger.Infow(strings.Repeat("中", 2000), String("tail", "kept"))
+		syncLogger(t, logger)
+
+		line := sink.String()
+		if len(line) > 1000 || !strings.HasSuffix(line, "\n") {
+			t.Fatalf("%T: entry length %d, want <= 1000 ending with newline", enc, len(line))
+		}
+		if !strings.Contains(line, "...[truncated ") || !strings.Contains(line, "kept") {
+			t.Fatalf("%T: missing truncation marker or fields: %q", enc, line)
+		}
+		if _, ok := enc.(*JSONEncoder); ok && !json.Valid([]byte(line)) {
+			t.Fatalf("truncated JSON entry is not valid: %q", line)
+		}
+	}
+}
+
+//字段本身超过上限：截断编码后的日志串，带有截断标记
+func TestMaxEntrySizeCutsLongFields(t *testing.T) {
+	sink := &memorySink{}
+	logger := NewLogger(WithWriter(sink), WithEncoder(NewJSONEncoder()), WithMaxEntrySize(1000))
+	logger.With(String("ctx", strings.Repeat("c", 600))).Infow("short", String("big", strings.Repeat("b", 2000)))
+	syncLogger(t, logger)
+
+	line := sink.String()
+	if len(line) > 1000 || !strings.HasSuffix(line, " bytes]\n") || !strings.Contains(line, "...[truncated ") {
+		t.Fatalf("entry length %d, want <= 1000 ending with the truncation marker: %q", len(line), line)
+	}
+}
+
+func TestLogMsgWriteGrows(t *testing.T) {
+	msg := NewLogMsg()
+	chunk := []byte(strings.Repeat("a", 30000))
+	for i := 0; i < 3; i++ {
+		if n, err := msg.Write(chunk); n != len(chunk) || err != nil {
+			t.Fatalf("Write = %d, %v", n, err)
+		}
+	}
+	msg.appendByte('\n')
+	if msg.GetLength() != 90001 || msg.GetBytes()[90000] != '\n' {
+		t.Fatalf("length = %d", msg.GetLength())
+	}
+	msg.Clear()
+	if msg.logContentSize != DEFALUT_LOG_SIZE {
+		t.Fatalf("pooled size after Clear = %d", msg.logContentSize)
+	}
+}
+
+func TestFlushLevelWritesImmediately(t *testing.T) {
+	sink := &memorySink{}
+	logger := NewLogger(WithWriter(sink), WithFlushInterval(60), WithFlushLevel(ErrorLevel, 5*time.Second))
+	logger.Infow("queued")
+	if strings.Contains(sink.String(), "queued") {
+		t.Fatal("info entry written before the flush interval")
+	}
+	logger.Errorw("crash reason")
+	if s := sink.String(); !strings.Contains(s, "queued") || !strings.Contains(s, "crash reason") {
+		t.Fatalf("error entry not flushed on return: %q", s)
+	}
+}
+
+//记录Sync()调用次数的Sink
+type syncingSink struct {
+	memorySink
+	synced atomic.Int32
+}
+
+func (s *syncingSink) Sync() error {
+	s.synced.Add(1)
+	return nil
+}
+
+func TestFatalSyncsAndExits(t *testing.T) {
+	var code atomic.Int32
+	osExit = func(c int) { code.Store(int32(c)) }
+	defer func() { osExit = os.Exit }()
+
+	sink := &syncingSink{}
+	logger := NewLogger(WithWriter(sink), WithFlushInterval(60), WithFatalExitCode(3))
+	logger.Infow("before")
+	logger.Fatalw("boom")
+
+	if code.Load() != 3 {
+		t.Fatalf("exit code = %d, want 3", code.Load())
+	}
+	if s := sink.String(); !strings.Contains(s, "before") || !strings.Contains(s, "boom") {
+		t.Fatalf("content before exit = %q", s)
+	}
+	if sink.synced.Load() == 0 {
+		t.Fatal("writer was not synced before exit")
+	}
+}
+
+func TestPanicLogsThenPanics(t *testing.T) {
+	sink := &memorySink{}
+	logger := NewLogger(WithWriter(sink), WithFlushInterval(60))
+	defer func() {
+		if r := recover(); r != "bad state" {
+			t.Fatalf("recovered %v, want bad state", r)
+		}
+		if s := sink.String(); !strings.Contains(s, "PANIC") || !strings.Contains(s, "bad state") {
+			t.Fatalf("panic entry not written before panicking: %q", s)
+		}
+	}()
+	logger.Panicw("bad state")
+}
+
+//PanicLevel 是后加入的，不能改变已有级别的取值
+func TestLevelValues(t *testing.T) {
+	levels := []LogLevel{DebugLevel, InfoLevel, WarnLevel, ErrorLevel, FatalLevel, PanicLevel}
+	names := []string{"DEBUG", " INFO", " WARN", "ERROR", "FATAL", "PANIC"}
+	for i, level := range levels {
+		if level != LogLevel(i) || LEVEL_FLAGS[level] != names[i] {
+			t.Errorf("level %d = %d %q, want %d %q", i, level, LEVEL_FLAGS[level], i, names[i])
+		}
+	}
+
+	//RecoverLevel(PanicLevel) 只记录，不退出进程
+	var exited atomic.Bool
+	osExit = func(int) { exited.Store(true) }
+	defer func() { osExit = os.Exit }()
+	sink := &memorySink{}
+	logger := NewLogger(WithWriter(sink), WithFlushInterval(60))
+	func() {
+		defer logger.Recover(RecoverLevel(PanicLevel))
+		panic("boom")
+	}()
+	if exited.Load() || !strings.Contains(sink.String(), "PANIC") {
+		t.Fatalf("exited = %v, content = %q", exited.Load(), sink.String())
+	}
+}
+
+func TestRecoverLogsStackAndFlushes(t *testing.T) {
+	sink := &memorySink{}
+	logger := NewLogger(WithWriter(sink), WithFlushInterval(60))
+	var line int
+	func() {
+		defer logger.Recover()
+		var p *int
+		_, _, line, _ = runtime.Caller(0)
+		*p = 1
+	}()
+
+	s := sink.String()
+	if !strings.Contains(s, "ERROR") || !strings.Contains(s, "panic: runtime error: invalid memory address") {
+		t.Fatalf("recovered panic not logged: %q", s)
+	}
+	//源文件名、行号是panic的位置，调用栈 从panic所在的函数开始
+	site := "log_test.go:" + strconv.Itoa(line+1)
+	if !strings.Contains(s, " "+site+":") || !strings.Contains(s, " - panic: ") {
+		t.Fatalf("header does not point at the panic site %s: %q", site, s)
+	}
+	if !strings.Contains(s, "\n\tgithub.com/baozh/zlog.TestRecoverLogsStackAndFlushes.func1\n\t\t") || !strings.Contains(s, site+"\n") {
+		t.Fatalf("missing stack block: %q", s)
+	}
+}
+
+func TestRecoverRepanic(t *testing.T) {
+	sink := &memorySink{}
+	logger := NewLogger(WithWriter(sink), WithFlushInterval(60))
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Fatalf("recovered %v, want boom", r)
+		}
+		if !strings.Contains(sink.String(), "panic: boom") {
+			t.Fatalf("panic not logged before re-panicking: %q", sink.String())
+		}
+	}()
+	func() {
+		defer logger.Recover(RecoverLevel(FatalLevel), RecoverRepanic())
+		panic("boom")
+	}()
+}
+
+func TestStackLevel(t *testing.T) {
+	sink := &memorySink{}
+	logger := NewLogger(WithWriter(sink), WithStackLevel(ErrorLevel), WithPrintFileNameLineNo(false))
+	logger.Infow("no stack")
+	logger.Errorw("with stack")
+	syncLogger(t, logger)
+
+	lines := strings.Split(sink.String(), "\n")
+	if !strings.HasSuffix(lines[0], "no stack") || !strings.HasSuffix(lines[1], "with stack") {
+		t.Fatalf("unexpected entries: %q", sink.String())
+	}
+	if lines[2] != "\tgithub.com/baozh/zlog.TestStackLevel" || !strings.HasPrefix(lines[3], "\t\t") || !strings.Contains(lines[3], "log_test.go:") {
+		t.Fatalf("stack block should start at the logging function: %q", lines[2:4])
+	}
+
+	jsonSink := &memorySink{}
+	logger = NewLogger(WithWriter(jsonSink), WithEncoder(NewJSONEncoder()), WithStackLevel(WarnLevel))
+	logger.Warnw("json stack")
+	syncLogger(t, logger)
+	var entry struct {
+		Stack []struct {
+			Func string
+			File string
+			Line int
+		}
+	}
+	if err := json.Unmarshal([]byte(jsonSink.String()), &entry); err != nil {
+		t.Fatalf("invalid JSON %q: %v", jsonSink.String(), err)
+	}
+	if len(entry.Stack) == 0 || entry.Stack[0].Func != "github.com/baozh/zlog.TestStackLevel" || entry.Stack[0].Line == 0 {
+		t.Fatalf("stack frames = %+v", entry.Stack)
+	}
+}
+
+//源文件名和行号 必须是用户调用的位置，而不是zlog内部 (runtime.Caller的深度)
+func TestCallerIsCallSite(t *testing.T) {
+	sink := &memorySink{}
+	logger := NewLogger(WithWriter(sink))
+	child := logger.With(String("k", "v"))
+
+	var lines []int
+	callSite := func() {
+		_, _, line, _ := runtime.Caller(1)
+		lines = append(lines, line-1) //调用callSite的前一行
+	}
+	logger.Debug("debug")
+	callSite()
+	logger.Info("info")
+	callSite()
+	logger.Infof("infof %d", 1)
+	callSite()
+	logger.Infow("infow", Int("n", 1))
+	callSite()
+	logger.Warnf("warnf")
+	callSite()
+	logger.Errorw("errorw")
+	callSite()
+	child.Infow("child")
+	callSite()
+	syncLogger(t, logger)
+
+	out := strings.Split(strings.TrimSpace(sink.String()), "\n")
+	if len(out) != len(lines) {
+		t.Fatalf("got %d entries, want %d: %q", len(out), len(lines), out)
+	}
+	for i, line := range out {
+		want := "log_test.go:" + strconv.Itoa(lines[i]) + ":"
+		if !strings.Contains(line, want) || !strings.Contains(line, ".TestCallerIsCallSite - ") {
+			t.Errorf("entry %q does not contain %q", line, want)
+		}
+	}
+}
+
+//包级函数 与 Logger的方法 调用深度相同
+func TestPackageLevelCallerIsCallSite(t *testing.T) {
+	sink := &memorySink{}
+	if err := Default().SetWriter(sink); err != nil {
+		t.Fatal(err)
+	}
+	defer Default().SetWriter(NewConsoleWriter())
+
+	var lines []int
+	callSite := func() {
+		_, _, line, _ := runtime.Caller(1)
+		lines = append(lines, line-1)
+	}
+	Infoln("infoln")
+	callSite()
+	Infolnf("infolnf %d", 1)
+	callSite()
+	Infow("infow", Int("n", 1))
+	callSite()
+	With(String("k", "v")).Infow("child")
+	callSite()
+	syncLogger(t, Default())
+
+	out := strings.Split(strings.TrimSpace(sink.String()), "\n")
+	if len(out) != len(lines) {
+		t.Fatalf("got %d entries, want %d: %q", len(out), len(lines), out)
+	}
+	for i, line := range out {
+		want := "log_test.go:" + strconv.Itoa(lines[i]) + ":"
+		if !strings.Contains(line, want) || !strings.Contains(line, ".TestPackageLevelCallerIsCallSite - ") {
+			t.Errorf("entry %q does not contain %q", line, want)
+		}
+	}
+}
+
+func TestSetEncoder(t *testing.T) {
+	sink := &memorySink{}
+	logger := NewLogger(WithWriter(sink), WithPrintFileNameLineNo(false))
+	logger.Infow("text")
+	if err := logger.SetEncoder(NewJSONEncoder()); err != nil {
+		t.Fatal(err)
+	}
+	logger.Infow("json")
+	if err := logger.SetWriter(sink); err != nil {
+		t.Fatal(err)
+	}
+	logger.Infow("kept")
+	syncLogger(t, logger)
+
+	lines := strings.Split(strings.TrimSpace(sink.String()), "\n")
+	if len(lines) != 3 || json.Valid([]byte(lines[0])) || !json.Valid([]byte(lines[1])) || !json.Valid([]byte(lines[2])) {
+		t.Fatalf("entries = %q", lines)
+	}
+	if logger.SetEncoder(nil) == nil {
+		t.Fatal("SetEncoder(nil) should fail")
+	}
+}
+
+//SetWriteTypeFile/SetWriteTypeConsole 保留用户选择的编码器
+func TestSetWriteTypeKeepsChosenEncoder(t *testing.T) {
+	defer func() {
+		defaultLogger.encoderChosen.Store(false)
+		SetWriteTypeConsole()
+	}()
+
+	enc := NewJSONEncoder()
+	if err := SetEncoder(enc); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := SetWriteTypeFile(dir); err != nil {
+		t.Fatal(err)
+	}
+	Infow("to file")
+	syncLogger(t, Default())
+	if Default().getEncoder() != enc {
+		t.Fatalf("SetWriteTypeFile replaced the encoder with %T", Default().getEncoder())
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("log dir entries = %v, %v", entries, err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	if err != nil || !json.Valid(bytes.TrimSpace(content)) {
+		t.Fatalf("file content = %q, %v", content, err)
+	}
+
+	if err := SetWriteTypeConsole(); err != nil {
+		t.Fatal(err)
+	}
+	if Default().getEncoder() != enc {
+		t.Fatalf("SetWriteTypeConsole replaced the encoder with %T", Default().getEncoder())
+	}
+
+	//没有选择过编码器时，按writer使用默认的编码器
+	defaultLogger.encoderChosen.Store(false)
+	if err := SetWriteTypeConsole(); err != nil {
+		t.Fatal(err)
+	}
+	if te, ok := Default().getEncoder().(*TextEncoder); !ok || !te.Colored {
+		t.Fatalf("default console encoder = %#v", Default().getEncoder())
+	}
+}
@@ -0,0 +1,48 @@
+package zlog
+
+//运行期可修改的Logger状态，打印日志的routine 和 刷日志routine 都会读取，所以都用原子操作
+
+//atomic.Pointer 只能存放具体类型，用结构体 包装接口
+type sinkHolder struct {
+	Sink
+}
+
+type encoderHolder struct {
+	Encoder
+}
+
+func (l *Logger) getWriter() Sink {
+	if h := l.writer.Load(); h != nil {
+		return h.Sink
+	}
+	return nil
+}
+
+func (l *Logger) setWriter(writer Sink) {
+	l.writer.Store(&sinkHolder{writer})
+}
+
+func (l *Logger) getEncoder() Encoder {
+	if h := l.encoder.Load(); h != nil {
+		return h.Encoder
+	}
+	return nil
+}
+
+func (l *Logger) setEncoder(encoder Encoder) {
+	l.encoder.Store(&encoderHolder{encoder})
+}
+
+//修改日志级别，可在运行期 与打印日志 并发调用
+func (l *Logger) SetLevel(level LogLevel) {
+	l.currentLevel.Store(uint32(level))
+}
+
+func (l *Logger) Level() LogLevel {
+	return LogLevel(l.currentLevel.Load())
+}
+
+//设置 是否 在日志中打印 （文件名，行号，函数名），可在运行期 与打印日志 并发调用
+func (l *Logger) SetPrintFileNameLineNo(isAble bool) {
+	l.isPrintFileNameLineNo.Store(isAble)
+}
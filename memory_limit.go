@@ -0,0 +1,71 @@
+package zlog
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+//所有buffer(包括 OverflowSpill的临时buffer) 共用的内存额度
+//limit为0表示不限制，但仍然统计 已分配的字节数
+type memoryBudget struct {
+	limit int64
+	used  atomic.Int64
+}
+
+func newMemoryBudget(limit int) *memoryBudget {
+	return &memoryBudget{limit: int64(limit)}
+}
+
+//申请n个字节的额度，超过上限时 返回false
+func (b *memoryBudget) reserve(n int) bool {
+	if b == nil || n <= 0 {
+		return true
+	}
+	for {
+		used := b.used.Load()
+		if b.limit > 0 && used+int64(n) > b.limit {
+			return false
+		}
+		if b.used.CompareAndSwap(used, used+int64(n)) {
+			return true
+		}
+	}
+}
+
+func (b *memoryBudget) release(n int) {
+	if b == nil || n <= 0 {
+		return
+	}
+	b.used.Add(-int64(n))
+}
+
+func (b *memoryBudget) canReserve(n int) bool {
+	if b == nil || b.limit <= 0 {
+		return true
+	}
+	return b.used.Load()+int64(n) <= b.limit
+}
+
+func (b *memoryBudget) inUse() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.used.Load()
+}
+
+//没有日志多久之后 释放空闲的buffer
+const DEFAULT_IDLE_RELEASE = time.Minute
+
+//释放emptyBuffers中的buffer，各分片的currentBuffer 收缩到初始大小
+//在 刷日志routine 中调用
+func (l *Logger) releaseIdleBuffers() {
+	l.emptyBuffers.ReleaseIdle()
+	for i := range l.shards {
+		shard := &l.shards[i]
+		shard.mutex.Lock()
+		if shard.currentBuffer != nil {
+			shard.currentBuffer.shrink()
+		}
+		shard.mutex.Unlock()
+	}
+}
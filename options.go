@@ -0,0 +1,180 @@
+package zlog
+
+import (
+	"time"
+)
+
+//Logger的可选配置项，用法：NewLogger(WithLevel(InfoLevel), WithWriter(fw))
+type Option func(*Logger)
+
+//设置 日志输出的目的地(默认输出到屏幕)
+func WithWriter(writer Sink) Option {
+	return func(l *Logger) {
+		if writer != nil {
+			l.setWriter(writer)
+		}
+	}
+}
+
+//设置 日志的编码格式(默认为文本格式，输出到屏幕时带颜色)，例如 WithEncoder(NewJSONEncoder())
+func WithEncoder(encoder Encoder) Option {
+	return func(l *Logger) {
+		if encoder != nil {
+			l.setEncoder(encoder)
+			l.encoderChosen.Store(true)
+		}
+	}
+}
+
+//设置 日志级别
+func WithLevel(level LogLevel) Option {
+	return func(l *Logger) {
+		l.SetLevel(level)
+	}
+}
+
+//设置 刷出日志的间隔 (单位：秒)
+func WithFlushInterval(sec int) Option {
+	return func(l *Logger) {
+		if sec > 0 {
+			l.flushInterval = sec
+		}
+	}
+}
+
+//设置 buffer的最大个数，buffer按需分配，不会一开始就全部分配
+func WithBufferNum(num int) Option {
+	return func(l *Logger) {
+		if num > 0 {
+			l.bufferNum = num
+		}
+	}
+}
+
+//设置 每个buffer的容量 (单位：字节)，buffer从较小的空间开始，写入时 增长到这个容量
+func WithBufferSize(size int) Option {
+	return func(l *Logger) {
+		if size > 0 {
+			l.bufferSize = size
+		}
+	}
+}
+
+//设置 是否 在日志中打印 （文件名，行号，函数名）
+func WithPrintFileNameLineNo(isAble bool) Option {
+	return func(l *Logger) {
+		l.isPrintFileNameLineNo.Store(isAble)
+	}
+}
+
+//设置 writer出错时的回调，在 刷日志routine 中调用，不要在回调中阻塞 或 打印日志到同一个Logger
+func WithErrorHandler(handler func(err error)) Option {
+	return func(l *Logger) {
+		l.errorHandler = handler
+	}
+}
+
+//设置 writer写入失败时的备用输出(默认输出到标准错误)，nil表示不使用备用输出
+func WithFallback(fallback Sink) Option {
+	return func(l *Logger) {
+		l.fallback = fallback
+	}
+}
+
+//没有可用的buffer时 丢弃新的日志(默认)
+func WithOverflowDropNewest() Option {
+	return func(l *Logger) {
+		l.overflowPolicy = OverflowDropNewest
+	}
+}
+
+//没有可用的buffer时 阻塞，等待 刷日志routine 腾出buffer，最多等待timeout，<=0表示一直等待
+//适用于 不能丢失的日志(如 审计日志)
+func WithOverflowBlock(timeout time.Duration) Option {
+	return func(l *Logger) {
+		l.overflowPolicy = OverflowBlock
+		l.overflowTimeout = timeout
+	}
+}
+
+//没有可用的buffer时 在堆上临时分配buffer，临时buffer的总大小 不超过maxBytes(<=0表示 一个buffer的大小)
+func WithOverflowSpill(maxBytes int) Option {
+	return func(l *Logger) {
+		l.overflowPolicy = OverflowSpill
+		l.spillLimit = maxBytes
+	}
+}
+
+//空闲buffer不多时 丢弃低于keepLevel的日志，keepLevel及以上的日志 等待buffer，不丢弃
+func WithOverflowDropByLevel(keepLevel LogLevel) Option {
+	return func(l *Logger) {
+		l.overflowPolicy = OverflowDropByLevel
+		l.keepLevel = keepLevel
+	}
+}
+
+//设置 所有buffer占用内存的上限 (单位：字节)，包括OverflowSpill的临时buffer，0表示不限制
+//达到上限后 不再分配新的buffer，按overflow策略处理新的日志
+func WithMemoryLimit(bytes int) Option {
+	return func(l *Logger) {
+		if bytes >= 0 {
+			l.memoryLimit = bytes
+		}
+	}
+}
+
+//设置 没有日志多久之后 释放空闲的buffer，交给GC回收，<=0表示不释放
+func WithIdleRelease(d time.Duration) Option {
+	return func(l *Logger) {
+		l.idleRelease = d
+	}
+}
+
+//设置 分片的个数(默认1)：多个routine并发打印时，分散到各分片的buffer，减少锁竞争，一般设为 runtime.GOMAXPROCS(0)
+//多于一个分片时，分片之间的日志 不保证顺序，每条日志 带有序号(Entry.Seq)，便于下游排序
+func WithShards(n int) Option {
+	return func(l *Logger) {
+		if n > 0 {
+			l.shardNum = n
+		}
+	}
+}
+
+//设置 单条日志的最大长度 (单位：字节，默认1MB)，超过时截断，截断处 带有 ...[truncated N bytes] 标记
+//比一个buffer还大 但不超过这个长度的日志，单独分配buffer写出；<=0表示不限制，不足256时 按256处理
+func WithMaxEntrySize(size int) Option {
+	return func(l *Logger) {
+		switch {
+		case size <= 0:
+			l.maxEntrySize = 0
+		case size < MIN_MAX_ENTRY_SIZE:
+			l.maxEntrySize = MIN_MAX_ENTRY_SIZE
+		default:
+			l.maxEntrySize = size
+		}
+	}
+}
+
+//设置 打印level及以上的日志后 立即写出：把当前buffer交给 刷日志routine，最多等待wait，直到写入writer并Flush
+//wait<=0 表示只交给 刷日志routine，不等待. 默认不立即写出，只有Fatal日志 总是写出并落盘后 再退出
+func WithFlushLevel(level LogLevel, wait time.Duration) Option {
+	return func(l *Logger) {
+		l.flushLevel = level
+		l.flushWait = wait
+	}
+}
+
+//设置 Fatal日志写出后 退出进程的返回码，默认为1
+func WithFatalExitCode(code int) Option {
+	return func(l *Logger) {
+		l.fatalExitCode = code
+	}
+}
+
+//设置 打印level及以上的日志时 记录调用栈(最多32层)，文本格式 在日志之后 每帧缩进输出，JSON格式 输出"stack"数组
+//默认不记录. 打印时 只记录PC，函数名、文件名、行号 在编码时解析并缓存
+func WithStackLevel(level LogLevel) Option {
+	return func(l *Logger) {
+		l.stackLevel = level
+	}
+}
@@ -0,0 +1,122 @@
+package zlog
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewLoggerDefaults(t *testing.T) {
+	logger := NewLogger()
+	defer logger.Close(context.Background())
+	if logger.Level() != DebugLevel {
+		t.Errorf("Level = %v, want DebugLevel", logger.Level())
+	}
+	if _, ok := logger.getWriter().(*ConsoleWriter); !ok {
+		t.Errorf("default writer = %T, want *ConsoleWriter", logger.getWriter())
+	}
+	if enc, ok := logger.getEncoder().(*TextEncoder); !ok || !enc.Colored {
+		t.Errorf("default console encoder = %#v, want a colored TextEncoder", logger.getEncoder())
+	}
+
+	sink := &memorySink{}
+	other := NewLogger(WithWriter(sink))
+	defer other.Close(context.Background())
+	if enc, ok := other.getEncoder().(*TextEncoder); !ok || enc.Colored {
+		t.Errorf("default encoder for other sinks = %#v, want a plain TextEncoder", other.getEncoder())
+	}
+}
+
+func TestLoggerOptions(t *testing.T) {
+	sink := &memorySink{}
+	enc := NewJSONEncoder()
+	logger := NewLogger(
+		WithWriter(sink),
+		WithEncoder(enc),
+		WithLevel(WarnLevel),
+		WithFlushInterval(7),
+		WithBufferNum(1),
+		WithBufferSize(4096),
+		WithShards(2),
+		WithPrintFileNameLineNo(false),
+		WithMaxEntrySize(10),
+		WithFlushLevel(ErrorLevel, time.Second),
+		WithStackLevel(PanicLevel),
+		WithFatalExitCode(3),
+	)
+	defer logger.Close(context.Background())
+
+	if logger.getWriter() != sink || logger.getEncoder() != enc {
+		t.Fatalf("writer = %T, encoder = %T", logger.getWriter(), logger.getEncoder())
+	}
+	if logger.Level() != WarnLevel || logger.flushInterval != 7 || logger.bufferSize != 4096 || logger.shardNum != 2 {
+		t.Fatalf("level = %v, flushInterval = %d, bufferSize = %d, shards = %d",
+			logger.Level(), logger.flushInterval, logger.bufferSize, logger.shardNum)
+	}
+	//每个分片 至少两个buffer
+	if logger.bufferNum != 4 {
+		t.Errorf("bufferNum = %d, want 4", logger.bufferNum)
+	}
+	if logger.maxEntrySize != MIN_MAX_ENTRY_SIZE {
+		t.Errorf("maxEntrySize = %d, want %d", logger.maxEntrySize, MIN_MAX_ENTRY_SIZE)
+	}
+	if logger.flushLevel != ErrorLevel || logger.flushWait != time.Second || logger.stackLevel != PanicLevel || logger.fatalExitCode != 3 {
+		t.Errorf("flushLevel = %v, flushWait = %v, stackLevel = %v, fatalExitCode = %d",
+			logger.flushLevel, logger.flushWait, logger.stackLevel, logger.fatalExitCode)
+	}
+}
+
+func TestLoggerOptionsIgnoreInvalidValues(t *testing.T) {
+	logger := NewLogger(
+		WithWriter(nil),
+		WithEncoder(nil),
+		WithFlushInterval(0),
+		WithBufferNum(-1),
+		WithBufferSize(0),
+		WithShards(0),
+		WithMaxEntrySize(-1),
+	)
+	defer logger.Close(context.Background())
+
+	if logger.getWriter() == nil || logger.getEncoder() == nil {
+		t.Fatal("nil writer or encoder replaced the defaults")
+	}
+	if logger.flushInterval != 3 || logger.bufferNum != DEFAULT_BUFFER_NUM || logger.bufferSize != DEFALUT_BUFFER_SIZE || logger.shardNum != 1 {
+		t.Errorf("flushInterval = %d, bufferNum = %d, bufferSize = %d, shards = %d",
+			logger.flushInterval, logger.bufferNum, logger.bufferSize, logger.shardNum)
+	}
+	if logger.maxEntrySize != 0 {
+		t.Errorf("maxEntrySize = %d, want 0 (unlimited)", logger.maxEntrySize)
+	}
+}
+
+func TestLoggersAreIndependent(t *testing.T) {
+	sinkA := &memorySink{}
+	sinkB := &memorySink{}
+	a := NewLogger(WithWriter(sinkA), WithLevel(ErrorLevel))
+	b := NewLogger(WithWriter(sinkB), WithLevel(DebugLevel), WithPrintFileNameLineNo(false))
+	defer a.Close(context.Background())
+	defer b.Close(context.Background())
+
+	a.Infow("a-info")
+	a.Errorw("a-error")
+	b.Infow("b-info")
+	b.SetLevel(ErrorLevel)
+	b.Infow("b-dropped")
+	syncLogger(t, a)
+	syncLogger(t, b)
+
+	if out := sinkA.String(); strings.Contains(out, "a-info") || !strings.Contains(out, "a-error") || strings.Contains(out, "b-") {
+		t.Errorf("logger a wrote %q", out)
+	}
+	if out := sinkB.String(); !strings.Contains(out, "b-info") || strings.Contains(out, "b-dropped") || strings.Contains(out, "a-") {
+		t.Errorf("logger b wrote %q", out)
+	}
+	if a.Level() != ErrorLevel {
+		t.Errorf("SetLevel on b changed a's level to %v", a.Level())
+	}
+	if !strings.Contains(sinkA.String(), "options_test.go:") || strings.Contains(sinkB.String(), "options_test.go:") {
+		t.Errorf("WithPrintFileNameLineNo leaked between loggers")
+	}
+}
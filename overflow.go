@@ -0,0 +1,126 @@
+package zlog
+
+import (
+	"time"
+)
+
+//没有可用的emptyBuffer时(消费速度 跟不上 生产速度)，如何处理新的日志
+type OverflowPolicy int
+
+const (
+	OverflowDropNewest  OverflowPolicy = iota //丢弃新的日志，有buffer可用后 写一行丢失日志的提示(默认)
+	OverflowBlock                             //阻塞打印日志的routine，等待 刷日志routine 腾出buffer，超时后丢弃
+	OverflowSpill                             //在堆上临时分配buffer，总大小不超过上限，超过后丢弃
+	OverflowDropByLevel                       //空闲buffer不多时 丢弃低级别的日志，高级别的日志 等待buffer，不丢弃
+)
+
+//OverflowBlock策略下，每次最多等待的时间，到时后 检查Logger是否已Close
+const overflowWaitSlice = 100 * time.Millisecond
+
+//OverflowDropByLevel策略下，空闲buffer 不多于这个数时，开始丢弃低级别的日志
+func (l *Logger) overflowReserve() int {
+	if l.overflowPolicy != OverflowDropByLevel {
+		return 0
+	}
+	if reserve := l.bufferNum / 4; reserve > 1 {
+		return reserve
+	}
+	return 1
+}
+
+//写入分片的currentBuffer，空间不够时 换一个emptyBuffer，没有可用的buffer时 返回false
+//调用时 持有分片的锁
+func (l *Logger) appendCurrent(s *bufferShard, msg *LogMsg) bool {
+	if s.currentBuffer == nil {
+		s.currentBuffer = l.emptyBuffers.PopBuffer()
+		if s.currentBuffer == nil {
+			return false
+		}
+	}
+	//先判断curBuf 是否有足够的空间写入
+	if s.currentBuffer.Grow(msg.GetLength()) {
+		s.currentBuffer.AppendByte(msg.GetBytes())
+		return true
+	}
+	//如果空间不够，则push 到 fullBufs，然后 申请一个emptyfull，写入 日志串，再唤醒 routine(flushFullBuffers).
+	l.fullBuffers.PushBuffer(s.currentBuffer)
+	s.currentBuffer = l.emptyBuffers.PopBuffer()
+	if s.currentBuffer == nil || !s.currentBuffer.Grow(msg.GetLength()) {
+		return false
+	}
+	s.currentBuffer.AppendByte(msg.GetBytes())
+	return true
+}
+
+//等待 刷日志routine 腾出emptyBuffer，最多等待timeout(<=0表示一直等待，直到Close)
+//调用时 持有分片的锁，等待期间 释放
+func (l *Logger) appendOrWait(s *bufferShard, msg *LogMsg, timeout time.Duration) bool {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	for {
+		if l.appendCurrent(s, msg) {
+			return true
+		}
+
+		wait := overflowWaitSlice
+		if timeout > 0 {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return false
+			}
+			if remaining < wait {
+				wait = remaining
+			}
+		}
+		s.mutex.Unlock()
+		l.emptyBuffers.WaitNewBufferTimeout(wait)
+		s.mutex.Lock()
+		if l.closed.Load() {
+			return false
+		}
+	}
+}
+
+//在堆上分配一个临时buffer，写出后 由GC回收，临时buffer 也受内存上限(WithMemoryLimit)的限制
+//调用时 持有分片的锁
+func (l *Logger) appendSpill(s *bufferShard, msg *LogMsg) bool {
+	limit := l.spillLimit
+	if limit <= 0 {
+		limit = l.bufferSize
+	}
+	size := l.bufferSize
+	if remain := limit - int(l.spillBytes.Load()); remain < size {
+		size = remain
+	}
+	if size <= msg.GetLength() {
+		return false
+	}
+
+	buf := newGrowableBuffer(size, size, l.budget)
+	if buf == nil {
+		return false
+	}
+	buf.spilled = true
+	l.spillBytes.Add(int64(size))
+	if s.currentBuffer != nil {
+		l.fullBuffers.PushBuffer(s.currentBuffer)
+	}
+	s.currentBuffer = buf
+	buf.AppendByte(msg.GetBytes())
+	return true
+}
+
+//低级别的日志：currentBuffer写满后，若空闲buffer不多了，则丢弃，把剩下的buffer 留给高级别的日志
+//调用时 持有分片的锁
+func (l *Logger) appendOrShed(s *bufferShard, msg *LogMsg) bool {
+	if s.currentBuffer != nil && s.currentBuffer.Grow(msg.GetLength()) {
+		s.currentBuffer.AppendByte(msg.GetBytes())
+		return true
+	}
+	if l.emptyBuffers.Available() <= l.overflowReserve() {
+		return false
+	}
+	return l.appendCurrent(s, msg)
+}
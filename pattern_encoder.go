@@ -0,0 +1,219 @@
+package zlog
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+//按 格式串 输出的文本编码器，格式串在创建时 编译成一组append操作，打印时 依次执行，不再解析格式串.
+//
+//支持的占位符：
+//
+//	%date           日期时间，默认格式同TextEncoder (20160609 23:31:21.770367)
+//	%date{layout}   日期时间，layout为Go的时间格式，如 %date{2006-01-02T15:04:05.000Z07:00}
+//	%level          日志级别
+//	%pid            进程ID
+//	%host           主机名
+//	%exe            可执行文件的名字
+//	%file           源文件名
+//	%path           源文件的完整路径
+//	%line           行号
+//	%func           函数名(带完整的包路径)
+//	%gid            Goroutine ID (从runtime.Stack中解析，比较耗时)
+//	%seq            日志的序号，分片多于一个时(WithShards) 才有，否则为0
+//	%msg            上下文字段 + 正文 + 结构化字段
+//	%stack          调用栈，每帧缩进 另起两行，WithStackLevel的级别及以上 才有，一般放在最后
+//	%%              字符 %
+//
+//例如 "%date{2006-01-02T15:04:05.000000Z07:00} %host %level %file:%line - %msg"
+//每条日志的末尾 自动加换行符.
+type PatternEncoder struct {
+	pattern string
+	ops     []patternOp
+}
+
+type patternOp func(msg *LogMsg, ent *Entry)
+
+const DefaultPattern = "%date %pid %level %file:%line:%func - %msg"
+
+func NewPatternEncoder(pattern string) (*PatternEncoder, error) {
+	ops, err := compilePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &PatternEncoder{pattern: pattern, ops: ops}, nil
+}
+
+func (enc *PatternEncoder) Pattern() string {
+	return enc.pattern
+}
+
+func (enc *PatternEncoder) EncodeEntry(msg *LogMsg, ent *Entry) {
+	for _, op := range enc.ops {
+		op(msg, ent)
+	}
+	msg.growByte('\n')
+}
+
+func (enc *PatternEncoder) EncodeFields(msg *LogMsg, fields []Field) {
+	msg.appendContextFields(fields)
+}
+
+func compilePattern(pattern string) ([]patternOp, error) {
+	var ops []patternOp
+	literal := make([]byte, 0, len(pattern))
+	flushLiteral := func() {
+		if len(literal) > 0 {
+			ops = append(ops, literalOp(string(literal)))
+			literal = literal[:0]
+		}
+	}
+
+	for i := 0; i < len(pattern); {
+		if pattern[i] != '%' {
+			literal = append(literal, pattern[i])
+			i++
+			continue
+		}
+		if i+1 < len(pattern) && pattern[i+1] == '%' {
+			literal = append(literal, '%')
+			i += 2
+			continue
+		}
+
+		//占位符的名字：% 之后的字母
+		j := i + 1
+		for j < len(pattern) && pattern[j] >= 'a' && pattern[j] <= 'z' {
+			j++
+		}
+		name := pattern[i+1 : j]
+
+		//可选的参数：{...}
+		arg := ""
+		if j < len(pattern) && pattern[j] == '{' {
+			end := strings.IndexByte(pattern[j:], '}')
+			if end < 0 {
+				return nil, errors.New("zlog: unterminated '{' in pattern: " + pattern)
+			}
+			arg = pattern[j+1 : j+end]
+			j += end + 1
+		}
+
+		op, err := patternTokenOp(name, arg)
+		if err != nil {
+			return nil, err
+		}
+		flushLiteral()
+		ops = append(ops, op)
+		i = j
+	}
+	flushLiteral()
+	return ops, nil
+}
+
+func patternTokenOp(name string, arg string) (patternOp, error) {
+	switch name {
+	case "date":
+		if arg == "" {
+			return appendDefaultDate, nil
+		}
+		return func(msg *LogMsg, ent *Entry) {
+			msg.setBytes(ent.Time.AppendFormat(msg.logContent[:msg.writeIndex], arg))
+		}, nil
+	case "level":
+		return func(msg *LogMsg, ent *Entry) {
+			msg.growString(LEVEL_FLAGS[ent.Level])
+		}, nil
+	case "pid":
+		return func(msg *LogMsg, ent *Entry) {
+			msg.AppendInt(int64(pid))
+		}, nil
+	case "host":
+		return literalOp(hostName), nil
+	case "exe":
+		return literalOp(baseName), nil
+	case "file":
+		return func(msg *LogMsg, ent *Entry) {
+			if ent.HasCaller {
+				msg.growString(ent.ShortFile())
+			}
+		}, nil
+	case "path":
+		return func(msg *LogMsg, ent *Entry) {
+			if ent.HasCaller {
+				msg.growString(ent.File)
+			}
+		}, nil
+	case "line":
+		return func(msg *LogMsg, ent *Entry) {
+			if ent.HasCaller {
+				msg.AppendInt(int64(ent.Line))
+			}
+		}, nil
+	case "func":
+		return func(msg *LogMsg, ent *Entry) {
+			if ent.HasCaller {
+				msg.growString(ent.Func)
+			}
+		}, nil
+	case "gid":
+		return appendGoroutineID, nil
+	case "seq":
+		return func(msg *LogMsg, ent *Entry) {
+			msg.setBytes(strconv.AppendUint(msg.logContent[:msg.writeIndex], ent.Seq, 10))
+		}, nil
+	case "stack":
+		return func(msg *LogMsg, ent *Entry) {
+			msg.appendTextStack(ent.Stack)
+		}, nil
+	case "msg":
+		return func(msg *LogMsg, ent *Entry) {
+			msg.growBytes(ent.Context)
+			msg.growBytes(ent.Message)
+			msg.appendFields(ent.Fields)
+		}, nil
+	}
+	return nil, errors.New("zlog: unknown pattern token %" + name)
+}
+
+func literalOp(value string) patternOp {
+	return func(msg *LogMsg, ent *Entry) {
+		msg.growString(value)
+	}
+}
+
+//与TextEncoder相同的格式：20160609 23:31:21.770367，手动组装
+func appendDefaultDate(msg *LogMsg, ent *Entry) {
+	now := ent.Time
+	year, month, day := now.Date()
+	hour, minute, second := now.Clock()
+
+	msg.reserve(24)
+	index := msg.writeIndex
+	msg.fourDigits(index, year)
+	msg.twoDigits(index+4, int(month))
+	msg.twoDigits(index+6, day)
+	msg.logContent[index+8] = ' '
+	msg.twoDigits(index+9, hour)
+	msg.logContent[index+11] = ':'
+	msg.twoDigits(index+12, minute)
+	msg.logContent[index+14] = ':'
+	msg.twoDigits(index+15, second)
+	msg.logContent[index+17] = '.'
+	msg.nDigits(6, index+18, now.Nanosecond()/1000, '0')
+	msg.writeIndex += 24
+}
+
+//runtime.Stack的第一行：goroutine 18 [running]:
+func appendGoroutineID(msg *LogMsg, ent *Entry) {
+	var buf [64]byte
+	stack := buf[:runtime.Stack(buf[:], false)]
+	stack = stack[len("goroutine "):]
+	if space := bytes.IndexByte(stack, ' '); space > 0 {
+		stack = stack[:space]
+	}
+	msg.growBytes(stack)
+}
@@ -0,0 +1,103 @@
+package zlog
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func encodePattern(t *testing.T, pattern string, ent *Entry) string {
+	t.Helper()
+	enc, err := NewPatternEncoder(pattern)
+	if err != nil {
+		t.Fatalf("NewPatternEncoder(%q): %v", pattern, err)
+	}
+	if enc.Pattern() != pattern {
+		t.Fatalf("Pattern() = %q, want %q", enc.Pattern(), pattern)
+	}
+	msg := NewLogMsg()
+	enc.EncodeEntry(msg, ent)
+	return string(msg.GetBytes())
+}
+
+func TestPatternTokens(t *testing.T) {
+	ent := &Entry{
+		Level:     WarnLevel,
+		Time:      time.Date(2026, 10, 18, 9, 30, 5, 123456789, time.UTC),
+		Seq:       7,
+		HasCaller: true,
+		File:      "/src/app/demo.go",
+		Line:      33,
+		Func:      "main.main",
+		Context:   []byte("req=abc "),
+		Message:   []byte("hello"),
+		Fields:    []Field{Int("n", 1)},
+	}
+	cases := []struct {
+		pattern string
+		want    string
+	}{
+		{"", ""},
+		{"plain text", "plain text"},
+		{"%date", "20261018 09:30:05.123456"},
+		{"%date{2006-01-02T15:04:05.000Z07:00}", "2026-10-18T09:30:05.123Z"},
+		{"[%level]", "[ WARN]"},
+		{"%pid", strconv.Itoa(pid)},
+		{"%host", hostName},
+		{"%exe", baseName},
+		{"%file:%line", "demo.go:33"},
+		{"%path", "/src/app/demo.go"},
+		{"%func", "main.main"},
+		{"#%seq", "#7"},
+		{"%msg", "req=abc hello n=1"},
+		{"100%%", "100%"},
+		{"%%level", "%level"},
+		{"%level1 %line-", " WARN1 33-"}, //占位符的名字 只含小写字母
+		{"%date{} %level", "20261018 09:30:05.123456  WARN"},
+		{DefaultPattern, "20261018 09:30:05.123456 " + strconv.Itoa(pid) + "  WARN demo.go:33:main.main - req=abc hello n=1"},
+	}
+	for _, c := range cases {
+		if got := encodePattern(t, c.pattern, ent); got != c.want+"\n" {
+			t.Errorf("pattern %q: got %q, want %q", c.pattern, got, c.want+"\n")
+		}
+	}
+}
+
+func TestPatternWithoutCaller(t *testing.T) {
+	ent := &Entry{Level: InfoLevel, File: "/src/app/demo.go", Line: 33, Func: "main.main", Message: []byte("m")}
+	if got := encodePattern(t, "%file:%line:%path:%func - %msg", ent); got != "::: - m\n" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestPatternGoroutineID(t *testing.T) {
+	got := strings.TrimSuffix(encodePattern(t, "%gid", &Entry{}), "\n")
+	if id, err := strconv.ParseUint(got, 10, 64); err != nil || id == 0 {
+		t.Fatalf("%%gid = %q", got)
+	}
+}
+
+func TestPatternErrors(t *testing.T) {
+	cases := []struct {
+		pattern string
+		errText string
+	}{
+		{"%date{2006-01-02", "unterminated '{'"},
+		{"%level %date{", "unterminated '{'"},
+		{"%bogus", "unknown pattern token %bogus"},
+		{"%Level", "unknown pattern token %"},
+		{"trailing %", "unknown pattern token %"},
+		{"%{x}", "unknown pattern token %"},
+	}
+	for _, c := range cases {
+		enc, err := NewPatternEncoder(c.pattern)
+		if err == nil || enc != nil {
+			t.Errorf("pattern %q: expected an error, got encoder %v", c.pattern, enc)
+			continue
+		}
+		if !strings.Contains(err.Error(), c.errText) {
+			t.Errorf("pattern %q: error %q does not contain %q", c.pattern, err, c.errText)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package zlog
+
+import (
+	"fmt"
+)
+
+//Recover()的选项
+type RecoverOption func(*recoverConfig)
+
+type recoverConfig struct {
+	level   LogLevel
+	repanic bool
+}
+
+//记录为该级别的日志(默认ErrorLevel)，FatalLevel 写出后 退出进程(同Fatal)，除非设置了RecoverRepanic
+func RecoverLevel(level LogLevel) RecoverOption {
+	return func(c *recoverConfig) {
+		c.level = level
+	}
+}
+
+//记录并写出后 继续panic，交给上层处理
+func RecoverRepanic() RecoverOption {
+	return func(c *recoverConfig) {
+		c.repanic = true
+	}
+}
+
+//用于defer：捕获panic，连同调用栈 记录到默认Logger，然后写出所有buffer并落盘，例如
+//
+//	go func() {
+//		defer zlog.Recover()
+//		...
+//	}()
+//
+//必须直接defer Recover，在其他函数中调用时 recover()不起作用
+func Recover(opts ...RecoverOption) {
+	if r := recover(); r != nil {
+		defaultLogger.recovered(r, opts)
+	}
+}
+
+//同zlog.Recover()，记录到该Logger
+func (l *Logger) Recover(opts ...RecoverOption) {
+	if r := recover(); r != nil {
+		l.recovered(r, opts)
+	}
+}
+
+func (l *Logger) recovered(r interface{}, opts []RecoverOption) {
+	cfg := recoverConfig{level: ErrorLevel}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if l.isEnabled(cfg.level) {
+		ent := l.newEntry(cfg.level)
+		//调用栈 以及 源文件名，行号 都从panic发生的位置开始，而不是Recover的调用者
+		ent.Stack = panicStack(ent.pcs[:], 2)
+		if ent.HasCaller {
+			ent.setCallerFromStack()
+		}
+		body := recordPool.Get().(*LogMsg)
+		fmt.Fprint(body, "panic: ", r)
+		ent.Message = body.GetBytes()
+		l.output(ent)
+		body.Clear()
+		recordPool.Put(body)
+	}
+
+	l.syncBeforeCrash()
+	if cfg.repanic {
+		panic(r)
+	}
+	if cfg.level == FatalLevel {
+		osExit(l.fatalExitCode)
+	}
+}
@@ -0,0 +1,82 @@
+package zlog
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+//一个分片：自己的currentBuffer和锁，打印日志的routine 分散到多个分片上，减少锁竞争
+//同一个分片内 日志的顺序 与写入的顺序一致；分片之间的顺序 用Entry.Seq确定
+type bufferShard struct {
+	mutex         sync.Mutex
+	currentBuffer *LogMsgBuffer
+	_             [48]byte //独占一个cache line，避免伪共享
+}
+
+//LogMsg的分片号，创建时 轮流分配
+var nextShard atomic.Uint32
+
+//从LogMsg的分片号开始，尝试加锁，遇到被占用的分片 换下一个；都被占用时 等待第一个
+func (l *Logger) lockShard(msg *LogMsg) *bufferShard {
+	n := uint32(len(l.shards))
+	if n == 1 {
+		l.shards[0].mutex.Lock()
+		return &l.shards[0]
+	}
+
+	start := msg.shard % n
+	for i := uint32(0); i < n; i++ {
+		shard := &l.shards[(start+i)%n]
+		if shard.mutex.TryLock() {
+			return shard
+		}
+	}
+	shard := &l.shards[start]
+	shard.mutex.Lock()
+	return shard
+}
+
+//把各分片 有内容的currentBuffer 放入fullBuffers，换上新的buffer
+func (l *Logger) pushShards() {
+	for i := range l.shards {
+		shard := &l.shards[i]
+		shard.mutex.Lock()
+		l.pushShardLocked(shard)
+		shard.mutex.Unlock()
+	}
+}
+
+//调用时 持有分片的锁
+func (l *Logger) pushShardLocked(shard *bufferShard) {
+	if shard.currentBuffer != nil && shard.currentBuffer.GetLength() > 0 {
+		l.fullBuffers.PushBuffer(shard.currentBuffer)
+		shard.currentBuffer = l.emptyBuffers.PopBuffer()
+	}
+}
+
+//各分片的currentBuffer中 尚未写出的字节数
+func (l *Logger) shardPendingBytes() int {
+	bytes := 0
+	for i := range l.shards {
+		shard := &l.shards[i]
+		shard.mutex.Lock()
+		if shard.currentBuffer != nil {
+			bytes += shard.currentBuffer.GetLength()
+		}
+		shard.mutex.Unlock()
+	}
+	return bytes
+}
+
+//锁住所有分片，执行f，用于 Close 等需要与所有写入互斥的操作
+func (l *Logger) withAllShardsLocked(f func()) {
+	for i := range l.shards {
+		l.shards[i].mutex.Lock()
+	}
+	defer func() {
+		for i := range l.shards {
+			l.shards[i].mutex.Unlock()
+		}
+	}()
+	f()
+}
@@ -0,0 +1,64 @@
+package zlog
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestShardedSeqGivesTotalOrder(t *testing.T) {
+	const goroutines, perGoroutine = 8, 500
+	sink := &memorySink{}
+	logger := NewLogger(WithWriter(sink), WithShards(4), WithPrintFileNameLineNo(false), WithFlushInterval(60))
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < perGoroutine; i++ {
+				logger.Infow("m", Int("g", g), Int("i", i))
+			}
+		}(g)
+	}
+	wg.Wait()
+	syncLogger(t, logger)
+
+	type line struct {
+		seq  uint64
+		g, i int
+	}
+	var lines []line
+	for _, text := range strings.Split(strings.TrimSpace(sink.String()), "\n") {
+		var l line
+		for _, word := range strings.Fields(text) {
+			switch {
+			case strings.HasPrefix(word, "#"):
+				l.seq, _ = strconv.ParseUint(word[1:], 10, 64)
+			case strings.HasPrefix(word, "g="):
+				l.g, _ = strconv.Atoi(word[2:])
+			case strings.HasPrefix(word, "i="):
+				l.i, _ = strconv.Atoi(word[2:])
+			}
+		}
+		lines = append(lines, l)
+	}
+	if len(lines) != goroutines*perGoroutine {
+		t.Fatalf("lines = %d, want %d", len(lines), goroutines*perGoroutine)
+	}
+
+	//按序号排序后，序号连续，每个routine的日志 按打印顺序排列
+	sort.Slice(lines, func(a, b int) bool { return lines[a].seq < lines[b].seq })
+	next := make([]int, goroutines)
+	for n, l := range lines {
+		if l.seq != uint64(n+1) {
+			t.Fatalf("seq %d at position %d", l.seq, n)
+		}
+		if l.i != next[l.g] {
+			t.Fatalf("goroutine %d: entry %d out of order, want %d", l.g, l.i, next[l.g])
+		}
+		next[l.g]++
+	}
+}
@@ -0,0 +1,81 @@
+package zlog
+
+import (
+	"errors"
+)
+
+//Sink的Write/Flush 出错时 可返回的错误，Unwritten为 没有写入目的地的内容(包括 之前的Write已缓存 尚未写出的)，
+//Logger把它们改写到备用输出. Write返回其他错误时，Logger认为 这次的content 没有写入.
+type WriteError struct {
+	Err       error
+	Unwritten []byte
+}
+
+func (e *WriteError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
+//atomic.Value 要求每次存入的类型相同，error的具体类型各不相同，所以包一层
+type errorValue struct {
+	err error
+}
+
+//writer出错的次数
+func (l *Logger) ErrorCount() uint64 {
+	return l.errCount.Load()
+}
+
+//writer最近一次的错误，没有出过错时 返回nil
+func (l *Logger) LastError() error {
+	if v, ok := l.lastErr.Load().(errorValue); ok {
+		return v.err
+	}
+	return nil
+}
+
+func (l *Logger) handleError(err error) {
+	l.errCount.Add(1)
+	l.lastErr.Store(errorValue{err})
+	if l.errorHandler != nil {
+		l.errorHandler(err)
+	}
+}
+
+//写入writer，失败时 改写到备用输出，避免日志无声无息地丢失
+func (l *Logger) writeToSink(content []byte) error {
+	writer := l.getWriter()
+	err := writer.Write(content)
+	if err == nil {
+		return nil
+	}
+	//先改写到备用输出，再通知错误处理函数：回调中 可以看到已经改写的日志
+	l.writeToFallback(writer, content, err)
+	l.handleError(err)
+	return err
+}
+
+func (l *Logger) flushSink() error {
+	writer := l.getWriter()
+	err := writer.Flush()
+	if err != nil {
+		l.writeToFallback(writer, nil, err)
+		l.handleError(err)
+	}
+	return err
+}
+
+//没有写入writer的内容 改写到备用输出：错误为*WriteError时 是其中的Unwritten，否则 是这次写入的content
+func (l *Logger) writeToFallback(writer Sink, content []byte, err error) {
+	var werr *WriteError
+	if errors.As(err, &werr) {
+		content = werr.Unwritten
+	}
+	if len(content) > 0 && l.fallback != nil && l.fallback != writer {
+		l.fallback.Write(content)
+		l.fallback.Flush()
+	}
+}
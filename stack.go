@@ -0,0 +1,134 @@
+package zlog
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+)
+
+//调用栈 最多记录的层数
+const maxStackDepth = 32
+
+//调用栈中的一帧
+type StackFrame struct {
+	Func string
+	File string
+	Line int
+}
+
+//PC 到 StackFrame的缓存：打印时 只用runtime.Callers记录PC，编码时 才解析成函数名、文件名、行号，
+//同一个PC 只解析一次. 一个PC 可能对应多帧(被内联的函数)
+var frameCache sync.Map //uintptr -> []StackFrame
+
+func framesForPC(pc uintptr) []StackFrame {
+	if v, ok := frameCache.Load(pc); ok {
+		return v.([]StackFrame)
+	}
+
+	var frames []StackFrame
+	iter := runtime.CallersFrames([]uintptr{pc})
+	for {
+		frame, more := iter.Next()
+		frames = append(frames, StackFrame{Func: frame.Function, File: frame.File, Line: frame.Line})
+		if !more {
+			break
+		}
+	}
+	frameCache.Store(pc, frames)
+	return frames
+}
+
+//依次处理 调用栈中的每一帧，从最内层的调用开始
+func forEachFrame(pcs []uintptr, fn func(frame *StackFrame)) {
+	afterSigpanic := false
+	for _, pc := range pcs {
+		//runtime.Callers记录的是返回地址，CallersFrames解析时 减1 回到调用指令；
+		//sigpanic之后的那一帧 记录的是出错指令本身，加1 抵消
+		if afterSigpanic {
+			pc++
+		}
+		frames := framesForPC(pc)
+		for i := range frames {
+			fn(&frames[i])
+		}
+		afterSigpanic = len(frames) > 0 && frames[len(frames)-1].Func == "runtime.sigpanic"
+	}
+}
+
+//解析 Entry.Stack，供第三方的编码器使用，结果追加到dst
+func (ent *Entry) StackFrames(dst []StackFrame) []StackFrame {
+	forEachFrame(ent.Stack, func(frame *StackFrame) {
+		dst = append(dst, *frame)
+	})
+	return dst
+}
+
+//文本格式的调用栈：每帧两行，函数名缩进一个tab，文件名:行号 缩进两个tab，与panic时的输出相同
+//
+//	main.handle
+//		/path/to/demo.go:33
+func (log *LogMsg) appendTextStack(pcs []uintptr) {
+	forEachFrame(pcs, func(frame *StackFrame) {
+		log.growString("\n\t")
+		log.growString(frame.Func)
+		log.growString("\n\t\t")
+		log.growString(frame.File)
+		log.growByte(':')
+		log.AppendInt(int64(frame.Line))
+	})
+}
+
+//JSON格式的调用栈：[{"func":"main.handle","file":"/path/to/demo.go","line":33},...]
+func (log *LogMsg) appendJSONStack(pcs []uintptr) {
+	log.growByte('[')
+	forEachFrame(pcs, func(frame *StackFrame) {
+		if log.lastByte() != '[' {
+			log.growByte(',')
+		}
+		log.growString(`{"func":`)
+		log.appendJSONString(frame.Func)
+		log.growString(`,"file":`)
+		log.appendJSONString(frame.File)
+		log.growString(`,"line":`)
+		log.AppendInt(int64(frame.Line))
+		log.growByte('}')
+	})
+	log.growByte(']')
+}
+
+//panic时的调用栈：从panic发生的位置开始，即 runtime.gopanic之后 第一个不属于runtime的函数
+//skip同runtime.Callers
+func panicStack(pcs []uintptr, skip int) []uintptr {
+	n := runtime.Callers(skip+1, pcs)
+	pcs = pcs[:n]
+	for i, pc := range pcs {
+		if fn := runtime.FuncForPC(pc - 1); fn == nil || fn.Name() != "runtime.gopanic" {
+			continue
+		}
+		for j := i + 1; j < n; j++ {
+			if fn := runtime.FuncForPC(pcs[j] - 1); fn != nil && !strings.HasPrefix(fn.Name(), "runtime.") {
+				if fn := runtime.FuncForPC(pcs[j-1] - 1); fn != nil && fn.Name() == "runtime.sigpanic" {
+					pcs[j]++ //同forEachFrame，截掉sigpanic后 在这里抵消
+				}
+				return pcs[j:]
+			}
+		}
+		break
+	}
+	return pcs
+}
+
+//Entry的源文件名、行号、函数名 设为调用栈的第一帧
+func (ent *Entry) setCallerFromStack() {
+	if len(ent.Stack) == 0 {
+		return
+	}
+	frames := framesForPC(ent.Stack[0])
+	if len(frames) == 0 {
+		return
+	}
+	frame := frames[0]
+	ent.File = frame.File
+	ent.Line = frame.Line
+	ent.Func = frame.Func
+}
@@ -0,0 +1,77 @@
+package zlog
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+//Logger的运行统计，用于监控告警
+type Stats struct {
+	DroppedEntries [len(LEVEL_FLAGS)]uint64 //按级别 丢弃的日志条数，下标为LogLevel
+	DroppedBytes   [len(LEVEL_FLAGS)]uint64 //按级别 丢弃的日志字节数
+	WriteErrors    uint64                   //writer出错的次数
+	MemoryInUse    int64                    //所有buffer 当前占用的内存 (单位：字节)
+}
+
+//所有级别 丢弃的日志条数之和
+func (s Stats) TotalDroppedEntries() uint64 {
+	var total uint64
+	for _, n := range s.DroppedEntries {
+		total += n
+	}
+	return total
+}
+
+//所有级别 丢弃的日志字节数之和
+func (s Stats) TotalDroppedBytes() uint64 {
+	var total uint64
+	for _, n := range s.DroppedBytes {
+		total += n
+	}
+	return total
+}
+
+//每个级别的计数器 各自原子更新，读取时 不加锁
+type dropCounters struct {
+	entries [len(LEVEL_FLAGS)]atomic.Uint64
+	bytes   [len(LEVEL_FLAGS)]atomic.Uint64
+}
+
+func (l *Logger) Stats() Stats {
+	var s Stats
+	for i := range s.DroppedEntries {
+		s.DroppedEntries[i] = l.dropped.entries[i].Load()
+		s.DroppedBytes[i] = l.dropped.bytes[i].Load()
+	}
+	s.WriteErrors = l.ErrorCount()
+	s.MemoryInUse = l.budget.inUse()
+	return s
+}
+
+func (l *Logger) countDrop(level LogLevel, size int) {
+	if int(level) >= len(LEVEL_FLAGS) {
+		return
+	}
+	l.dropped.entries[level].Add(1)
+	l.dropped.bytes[level].Add(uint64(size))
+}
+
+//上次提示之后 丢弃的日志：", Dropped:12, Bytes:3456, DEBUG:10, INFO:2"
+//只在 写丢失提示的routine(同一时刻只有一个) 中调用
+func (l *Logger) lossSummary() string {
+	stats := l.Stats()
+	var entries, bytes uint64
+	var levels strings.Builder
+	for i := range stats.DroppedEntries {
+		n := stats.DroppedEntries[i] - l.reported.DroppedEntries[i]
+		entries += n
+		bytes += stats.DroppedBytes[i] - l.reported.DroppedBytes[i]
+		if n > 0 {
+			levels.WriteString(", " + strings.TrimLeft(LEVEL_FLAGS[i], " ") + ":" + strconv.FormatUint(n, 10))
+		}
+	}
+	l.reported = stats
+
+	return ", Dropped:" + strconv.FormatUint(entries, 10) + ", Bytes:" + strconv.FormatUint(bytes, 10) + levels.String()
+}
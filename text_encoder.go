@@ -0,0 +1,78 @@
+package zlog
+
+import (
+	"strconv"
+)
+
+//文本格式的编码器，日志串的格式：
+//日期    时间.微秒    pid   日志级别  源文件名：行号：函数名 -   正文
+//20160609 23:31:21.770367   28599 ERROR demo.go:33:main.main - Hello
+//分片多于一个时(WithShards)，日志级别之后 带有序号：
+//20160609 23:31:21.770367   28599 ERROR #1024 demo.go:33:main.main - Hello
+type TextEncoder struct {
+	Colored bool //不同的日志级别，用不同的颜色输出(适用于屏幕)
+}
+
+var levelColors = [...]string{"\033[34m", "\033[32m", "\033[33m", "\033[31m", "\033[35m", "\033[91m"}
+
+func NewTextEncoder() *TextEncoder {
+	return &TextEncoder{}
+}
+
+func NewColorTextEncoder() *TextEncoder {
+	return &TextEncoder{Colored: true}
+}
+
+func (enc *TextEncoder) EncodeEntry(msg *LogMsg, ent *Entry) {
+	enc.formatHeader(msg, ent)
+	msg.appendTextBody(ent)
+}
+
+func (enc *TextEncoder) EncodeFields(msg *LogMsg, fields []Field) {
+	msg.appendContextFields(fields)
+}
+
+func (enc *TextEncoder) formatHeader(msg *LogMsg, ent *Entry) {
+	// 手动组装日志串，而不是用Sprintf，因为Sprintf比较耗时.
+	now := ent.Time
+	year, month, day := now.Date()
+	hour, minute, second := now.Clock()
+	msg.fourDigits(0, year)
+	msg.twoDigits(4, int(month))
+	msg.twoDigits(6, day)
+	msg.logContent[8] = ' '
+	msg.twoDigits(9, hour)
+	msg.logContent[11] = ':'
+	msg.twoDigits(12, minute)
+	msg.logContent[14] = ':'
+	msg.twoDigits(15, second)
+	msg.logContent[17] = '.'
+	msg.nDigits(6, 18, now.Nanosecond()/1000, '0')
+	msg.logContent[24] = ' '
+	msg.nDigits(7, 25, pid, ' ')
+	msg.logContent[32] = ' '
+	msg.writeIndex = 33
+	if enc.Colored {
+		msg.appendString(levelColors[ent.Level])
+		msg.appendString(LEVEL_FLAGS[ent.Level])
+		msg.appendString("\033[0m")
+	} else {
+		msg.appendString(LEVEL_FLAGS[ent.Level])
+	}
+	if ent.Seq != 0 {
+		msg.appendString(" #")
+		msg.setBytes(strconv.AppendUint(msg.logContent[:msg.writeIndex], ent.Seq, 10))
+	}
+
+	if ent.HasCaller {
+		msg.appendString(" ")
+		msg.appendString(ent.ShortFile())
+		msg.appendString(":")
+		msg.appendInt(ent.Line)
+		msg.appendString(":")
+		msg.appendString(ent.Func)
+		msg.appendString(" - ")
+	} else {
+		msg.appendString(" - ")
+	}
+}